@@ -0,0 +1,55 @@
+package gateway
+
+import (
+	"github.com/gin-gonic/gin"
+	errors "github.com/haderianous/go-error"
+	"strings"
+)
+
+type methodNotAllowedHandler struct {
+	engine *gin.Engine
+}
+
+// newMethodNotAllowedHandler answers requests whose path is routed for other
+// methods only, listing those methods in the Allow header.
+func newMethodNotAllowedHandler(engine *gin.Engine) Handler {
+	return &methodNotAllowedHandler{engine: engine}
+}
+
+func (h *methodNotAllowedHandler) Handle(req Request) (any, errors.ErrorModel) {
+	var allowed []string
+	seen := map[string]bool{}
+	for _, route := range h.engine.Routes() {
+		if !seen[route.Method] && matchPath(route.Path, req.Request().URL.Path) {
+			seen[route.Method] = true
+			allowed = append(allowed, route.Method)
+		}
+	}
+	req.Writer().Header().Set("Allow", strings.Join(allowed, ", "))
+	return nil, DefaultMethodNotAllowedError
+}
+
+// matchPath reports whether path fits a gin route pattern with :param and
+// *catchAll segments.
+func matchPath(pattern, path string) bool {
+	patternParts := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathParts := strings.Split(strings.Trim(path, "/"), "/")
+	for i, part := range patternParts {
+		if strings.HasPrefix(part, "*") {
+			return true
+		}
+		if i >= len(pathParts) {
+			return false
+		}
+		if strings.HasPrefix(part, ":") {
+			if pathParts[i] == "" {
+				return false
+			}
+			continue
+		}
+		if part != pathParts[i] {
+			return false
+		}
+	}
+	return len(patternParts) == len(pathParts)
+}
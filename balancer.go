@@ -0,0 +1,246 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+type Strategy string
+
+const (
+	RoundRobin       Strategy = "round_robin"
+	LeastConnections Strategy = "least_connections"
+	Weighted         Strategy = "weighted"
+)
+
+type Upstream struct {
+	URL    *url.URL
+	Weight int
+}
+
+// Balancer picks one healthy upstream instance per request. Next returns a
+// done func that must be called once the request to the instance finishes.
+type Balancer interface {
+	Next() (target *url.URL, done func(), ok bool)
+	Start()
+	Stop()
+}
+
+type BalancerOption func(b *balancer)
+
+type instance struct {
+	url     *url.URL
+	weight  int
+	current int
+	active  int
+	healthy bool
+}
+
+type balancer struct {
+	mu        sync.Mutex
+	strategy  Strategy
+	instances []*instance
+	next      int
+
+	healthPath     string
+	healthInterval time.Duration
+	client         *http.Client
+	stop           chan struct{}
+	wg             sync.WaitGroup
+}
+
+func NewBalancer(strategy Strategy, upstreams []Upstream, opts ...BalancerOption) Balancer {
+	b := &balancer{
+		strategy: strategy,
+		client:   &http.Client{Timeout: 2 * time.Second},
+	}
+	for _, u := range upstreams {
+		weight := u.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		b.instances = append(b.instances, &instance{url: u.URL, weight: weight, healthy: true})
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// WithHealthCheck probes path on every instance each interval. An instance
+// answering with a status below 500 is kept in rotation, anything else takes
+// it out until a later probe succeeds.
+func WithHealthCheck(path string, interval time.Duration) BalancerOption {
+	return func(b *balancer) {
+		b.healthPath = path
+		b.healthInterval = interval
+	}
+}
+
+// WithHealthClient sets the client used by the health checker.
+func WithHealthClient(client *http.Client) BalancerOption {
+	return func(b *balancer) {
+		b.client = client
+	}
+}
+
+func (b *balancer) Next() (*url.URL, func(), bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var picked *instance
+	switch b.strategy {
+	case LeastConnections:
+		picked = b.leastConnections()
+	case Weighted:
+		picked = b.weighted()
+	default:
+		picked = b.roundRobin()
+	}
+	if picked == nil {
+		return nil, func() {}, false
+	}
+
+	picked.active++
+	var once sync.Once
+	done := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			picked.active--
+			b.mu.Unlock()
+		})
+	}
+	return picked.url, done, true
+}
+
+func (b *balancer) roundRobin() *instance {
+	for i := 0; i < len(b.instances); i++ {
+		in := b.instances[(b.next+i)%len(b.instances)]
+		if in.healthy {
+			b.next = (b.next + i + 1) % len(b.instances)
+			return in
+		}
+	}
+	return nil
+}
+
+func (b *balancer) leastConnections() *instance {
+	var picked *instance
+	for i := 0; i < len(b.instances); i++ {
+		in := b.instances[(b.next+i)%len(b.instances)]
+		if in.healthy && (picked == nil || in.active < picked.active) {
+			picked = in
+		}
+	}
+	b.next = (b.next + 1) % len(b.instances)
+	return picked
+}
+
+// weighted uses the smooth weighted round-robin from nginx, so heavier
+// instances are picked more often without being picked in bursts.
+func (b *balancer) weighted() *instance {
+	var picked *instance
+	total := 0
+	for _, in := range b.instances {
+		if !in.healthy {
+			continue
+		}
+		in.current += in.weight
+		total += in.weight
+		if picked == nil || in.current > picked.current {
+			picked = in
+		}
+	}
+	if picked != nil {
+		picked.current -= total
+	}
+	return picked
+}
+
+func (b *balancer) Start() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.stop != nil || b.healthPath == "" || b.healthInterval <= 0 {
+		return
+	}
+	b.stop = make(chan struct{})
+	b.wg.Add(1)
+	go b.healthCheck(b.stop)
+}
+
+func (b *balancer) Stop() {
+	b.mu.Lock()
+	stop := b.stop
+	b.stop = nil
+	b.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	b.wg.Wait()
+}
+
+func (b *balancer) healthCheck(stop chan struct{}) {
+	defer b.wg.Done()
+	ticker := time.NewTicker(b.healthInterval)
+	defer ticker.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	for {
+		b.checkAll(ctx)
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkAll probes every instance at once, so a slow instance does not hold
+// back the others.
+func (b *balancer) checkAll(ctx context.Context) {
+	b.mu.Lock()
+	instances := make([]*instance, len(b.instances))
+	copy(instances, b.instances)
+	b.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, in := range instances {
+		wg.Add(1)
+		go func(in *instance) {
+			defer wg.Done()
+			healthy := b.probe(ctx, in.url)
+			if ctx.Err() != nil {
+				return
+			}
+			b.mu.Lock()
+			in.healthy = healthy
+			b.mu.Unlock()
+		}(in)
+	}
+	wg.Wait()
+}
+
+func (b *balancer) probe(ctx context.Context, target *url.URL) bool {
+	u := *target
+	u.Path = joinURLPath(u.Path, b.healthPath)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return false
+	}
+	res, err := b.client.Do(req)
+	if err != nil {
+		return false
+	}
+	_ = res.Body.Close()
+	return res.StatusCode < http.StatusInternalServerError
+}
@@ -0,0 +1,161 @@
+package gateway
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newUpstream(t *testing.T, name string, healthy *atomic.Bool) (*httptest.Server, *url.URL) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" && healthy != nil && !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(name))
+	}))
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	return srv, u
+}
+
+func pick(b Balancer, n int) []string {
+	var hosts []string
+	for i := 0; i < n; i++ {
+		target, done, ok := b.Next()
+		if !ok {
+			hosts = append(hosts, "")
+			continue
+		}
+		hosts = append(hosts, target.Host)
+		done()
+	}
+	return hosts
+}
+
+func TestBalancer_RoundRobin(t *testing.T) {
+	_, a := newUpstream(t, "a", nil)
+	_, b := newUpstream(t, "b", nil)
+	bl := NewBalancer(RoundRobin, []Upstream{{URL: a}, {URL: b}})
+	assert.Equal(t, []string{a.Host, b.Host, a.Host, b.Host}, pick(bl, 4))
+}
+
+func TestBalancer_Weighted(t *testing.T) {
+	_, a := newUpstream(t, "a", nil)
+	_, b := newUpstream(t, "b", nil)
+	bl := NewBalancer(Weighted, []Upstream{{URL: a, Weight: 3}, {URL: b, Weight: 1}})
+	counts := map[string]int{}
+	for _, h := range pick(bl, 8) {
+		counts[h]++
+	}
+	assert.Equal(t, 6, counts[a.Host])
+	assert.Equal(t, 2, counts[b.Host])
+}
+
+func TestBalancer_LeastConnections(t *testing.T) {
+	_, a := newUpstream(t, "a", nil)
+	_, b := newUpstream(t, "b", nil)
+	bl := NewBalancer(LeastConnections, []Upstream{{URL: a}, {URL: b}})
+
+	first, done, _ := bl.Next()
+	second, _, _ := bl.Next()
+	assert.NotEqual(t, first.Host, second.Host)
+	done()
+	third, _, _ := bl.Next()
+	assert.Equal(t, first.Host, third.Host)
+}
+
+func TestBalancer_HealthCheck(t *testing.T) {
+	var healthy atomic.Bool
+	healthy.Store(true)
+	_, a := newUpstream(t, "a", &healthy)
+	_, b := newUpstream(t, "b", nil)
+	bl := NewBalancer(RoundRobin, []Upstream{{URL: a}, {URL: b}}, WithHealthCheck("/health", 10*time.Millisecond))
+	bl.Start()
+	defer bl.Stop()
+
+	healthy.Store(false)
+	assert.Eventually(t, func() bool {
+		hosts := pick(bl, 2)
+		return hosts[0] == b.Host && hosts[1] == b.Host
+	}, time.Second, 10*time.Millisecond)
+
+	healthy.Store(true)
+	assert.Eventually(t, func() bool {
+		hosts := pick(bl, 2)
+		return hosts[0] != hosts[1]
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRouterGroup_BalancedProxy(t *testing.T) {
+	_, a := newUpstream(t, "a", nil)
+	_, b := newUpstream(t, "b", nil)
+	bl := NewBalancer(RoundRobin, []Upstream{{URL: a}, {URL: b}})
+
+	s := NewServer(NewController(NewResponder(nil), nil))
+	rg := s.NewRouterGroup("api")
+	rg.BalancedProxy("svc", bl)
+	gw := httptest.NewServer(http.HandlerFunc(rg.ServeHttp))
+	defer gw.Close()
+
+	var bodies []string
+	for i := 0; i < 2; i++ {
+		res, err := http.Get(gw.URL + "/api/svc/x")
+		assert.Nil(t, err)
+		buf := make([]byte, 1)
+		_, _ = res.Body.Read(buf)
+		_ = res.Body.Close()
+		bodies = append(bodies, string(buf))
+	}
+	assert.Equal(t, []string{"a", "b"}, bodies)
+}
+
+func TestServer_BalancerLifecycle(t *testing.T) {
+	var healthy atomic.Bool
+	_, a := newUpstream(t, "a", &healthy)
+	_, b := newUpstream(t, "b", nil)
+	bl := NewBalancer(RoundRobin, []Upstream{{URL: a}, {URL: b}}, WithHealthCheck("/health", 10*time.Millisecond))
+
+	s := NewServer(NewController(NewResponder(nil), nil))
+	s.NewRouterGroup("api").BalancedProxy("svc", bl)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Serve(l)
+	}()
+
+	assert.Eventually(t, func() bool {
+		hosts := pick(bl, 2)
+		return hosts[0] == b.Host && hosts[1] == b.Host
+	}, time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, s.Shutdown(time.Second))
+	assert.NoError(t, <-served)
+	impl := bl.(*balancer)
+	impl.mu.Lock()
+	defer impl.mu.Unlock()
+	assert.Nil(t, impl.stop)
+}
+
+func TestBalancer_ProbesConcurrently(t *testing.T) {
+	slow := func() *url.URL {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(200 * time.Millisecond)
+		}))
+		t.Cleanup(srv.Close)
+		u, _ := url.Parse(srv.URL)
+		return u
+	}
+	bl := NewBalancer(RoundRobin, []Upstream{{URL: slow()}, {URL: slow()}, {URL: slow()}}, WithHealthCheck("/health", time.Minute))
+
+	start := time.Now()
+	bl.(*balancer).checkAll(context.Background())
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+}
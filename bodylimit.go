@@ -0,0 +1,50 @@
+package gateway
+
+import (
+	errors "github.com/haderianous/go-error"
+	"io"
+	"net/http"
+)
+
+const originalBodyKey = "gateway.originalBody"
+
+type bodyLimitHandler struct {
+	limit int64
+}
+
+// NewBodyLimitHandler rejects requests whose body is larger than limit bytes
+// with DefaultEntityTooLargeError. A route-level limit replaces the global
+// one set through ServerOptions.MaxBodySize, so it may be larger or smaller,
+// and like it applies before the group middlewares run.
+func NewBodyLimitHandler(limit int64) Handler {
+	return &bodyLimitHandler{limit: limit}
+}
+
+func (h *bodyLimitHandler) Handle(req Request) (any, errors.ErrorModel) {
+	r := req.Request()
+	if r.ContentLength > h.limit {
+		return nil, DefaultEntityTooLargeError
+	}
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	body := r.Body
+	if original, ok := req.GetKey(originalBodyKey); ok {
+		body = original.(io.ReadCloser)
+	} else {
+		req.SetKey(originalBodyKey, body)
+	}
+	r.Body = http.MaxBytesReader(req.Writer(), body, h.limit)
+	return nil, nil
+}
+
+// routeBodyLimitHandler applies the body limit of the matched route.
+type routeBodyLimitHandler struct{}
+
+func (h *routeBodyLimitHandler) Handle(req Request) (any, errors.ErrorModel) {
+	limit := req.Route().bodyLimit
+	if limit <= 0 {
+		return nil, nil
+	}
+	return (&bodyLimitHandler{limit: limit}).Handle(req)
+}
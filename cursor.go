@@ -0,0 +1,280 @@
+package gateway
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	errors "github.com/haderianous/go-error"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// CursorSigner signs the cursors of keyset pagination, clients can only send
+// back the cursors they were given.
+type CursorSigner struct {
+	secret []byte
+}
+
+func NewCursorSigner(secret []byte) *CursorSigner {
+	return &CursorSigner{secret: secret}
+}
+
+// cursor is the row a keyset page starts after, or ends before when
+// backward, given by the values of its order fields.
+type cursor struct {
+	Sorts    []Sort   `json:"s,omitempty"`
+	Values   []string `json:"v"`
+	Backward bool     `json:"b,omitempty"`
+	// Values converted to the types of their fields
+	values []any
+}
+
+func (s *CursorSigner) sign(c cursor) string {
+	payload, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(s.mac(payload))
+}
+
+func (s *CursorSigner) verify(token string) (cursor, bool) {
+	var c cursor
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return c, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return c, false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, s.mac(payload)) {
+		return c, false
+	}
+	return c, json.Unmarshal(payload, &c) == nil
+}
+
+func (s *CursorSigner) mac(payload []byte) []byte {
+	h := hmac.New(sha256.New, s.secret)
+	h.Write(payload)
+	return h.Sum(nil)
+}
+
+// keyColumn is a field of the order of a query.
+type keyColumn struct {
+	field FilterField
+	desc  bool
+}
+
+// keyColumns returns the order of sorts, DefaultSort when there are none,
+// ended by UniqueKey.
+func (s FilterSchema) keyColumns(sorts []Sort) ([]keyColumn, *paramError) {
+	if len(sorts) == 0 {
+		sorts = s.DefaultSort
+	}
+	columns := make([]keyColumn, 0, len(sorts)+1)
+	unique := false
+	for _, order := range sorts {
+		field, ok := s.Fields[order.Key]
+		if !ok || !field.Sortable {
+			return nil, unknownSortKey(order.Key)
+		}
+		columns = append(columns, keyColumn{field: field, desc: order.Value == "desc"})
+		unique = unique || order.Key == s.UniqueKey
+	}
+	if s.UniqueKey != "" && !unique {
+		field, ok := s.Fields[s.UniqueKey]
+		if !ok {
+			field = FilterField{Column: s.UniqueKey}
+		}
+		columns = append(columns, keyColumn{field: field})
+	}
+	return columns, nil
+}
+
+// bindCursor verifies token and checks it was made for sorts, unless the
+// request gave none.
+func (s FilterSchema) bindCursor(token string, sorts []Sort, given bool) (*cursor, *paramError) {
+	invalid := &paramError{param: "cursor", messageId: "InvalidCursor", message: "{{.Param}} is invalid.", malformed: true}
+	c, ok := s.Cursors.verify(token)
+	if !ok {
+		return nil, invalid
+	}
+	if given && !reflect.DeepEqual(sorts, c.Sorts) {
+		return nil, &paramError{param: "cursor", messageId: "CursorSortsMismatch", message: "{{.Param}} was made for other sorts."}
+	}
+	columns, paramErr := s.keyColumns(c.Sorts)
+	if paramErr != nil || len(columns) != len(c.Values) {
+		return nil, invalid
+	}
+	c.values = make([]any, len(columns))
+	for i, column := range columns {
+		if c.values[i], ok = column.field.Type.convert(c.Values[i]); !ok {
+			return nil, invalid
+		}
+	}
+	return &c, nil
+}
+
+func orderBy(columns []keyColumn, reverse bool) clause.OrderBy {
+	orders := make([]clause.OrderByColumn, 0, len(columns))
+	for _, c := range columns {
+		orders = append(orders, clause.OrderByColumn{Column: clause.Column{Name: c.field.Column}, Desc: c.desc != reverse})
+	}
+	return clause.OrderBy{Columns: orders}
+}
+
+// keyset matches the rows after values in the order of columns, or before
+// them when backward.
+func keyset(columns []keyColumn, values []any, backward bool) clause.Expression {
+	ors := make([]clause.Expression, 0, len(columns))
+	for i, c := range columns {
+		ands := make([]clause.Expression, 0, i+1)
+		for j := 0; j < i; j++ {
+			ands = append(ands, clause.Eq{Column: clause.Column{Name: columns[j].field.Column}, Value: values[j]})
+		}
+		column := clause.Column{Name: c.field.Column}
+		if c.desc != backward {
+			ands = append(ands, clause.Lt{Column: column, Value: values[i]})
+		} else {
+			ands = append(ands, clause.Gt{Column: column, Value: values[i]})
+		}
+		ors = append(ors, clause.And(ands...))
+	}
+	if len(ors) == 1 {
+		return ors[0]
+	}
+	return clause.Or(ors...)
+}
+
+// Find loads the page of p into dest, a pointer to a slice of the model of
+// db. Requests with a cursor get a keyset query in the order the cursor was
+// made with and leave the total out, the others are selected with Apply.
+// When schema has Cursors the Paginator gets the cursors of the neighbouring
+// pages. The Paginator is returned as by Apply.
+func (p FilterParams) Find(db *gorm.DB, schema FilterSchema, dest any) (Paginator, errors.ErrorModel) {
+	if err := schema.validate(); err != nil {
+		return nil, errors.DefaultServiceUnAvaialable.WithError(err)
+	}
+	p.paginator = p.pager()
+	if p.cursor == nil {
+		query, _, e := p.Apply(db, schema)
+		if e != nil {
+			return nil, e
+		}
+		tx := query.Find(dest)
+		if tx.Error != nil {
+			return nil, errors.DefaultServiceUnAvaialable.WithError(tx.Error)
+		}
+		rows := reflect.ValueOf(dest).Elem()
+		offset := (p.paginator.Page() - 1) * p.paginator.PerPage()
+		return p.paginator, p.setCursors(tx.Statement, schema, rows, offset+rows.Len() < p.paginator.Total(), p.paginator.Page() > 1)
+	}
+
+	db, e := p.where(db, schema)
+	if e != nil {
+		return nil, e
+	}
+	columns, paramErr := schema.keyColumns(p.cursor.Sorts)
+	if paramErr != nil {
+		return nil, paramErr.errorModel(p.language)
+	}
+	backward := p.cursor.Backward
+	limit := p.paginator.PerPage()
+	tx := db.Clauses(clause.Where{Exprs: []clause.Expression{keyset(columns, p.cursor.values, backward)}}, orderBy(columns, backward)).
+		Limit(limit + 1).Find(dest)
+	if tx.Error != nil {
+		return nil, errors.DefaultServiceUnAvaialable.WithError(tx.Error)
+	}
+	rows := reflect.ValueOf(dest).Elem()
+	more := rows.Len() > limit
+	if more {
+		rows.Set(rows.Slice(0, limit))
+	}
+	if backward {
+		swap := reflect.Swapper(rows.Interface())
+		for i, j := 0, rows.Len()-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+		}
+		return p.paginator, p.setCursors(tx.Statement, schema, rows, true, more)
+	}
+	return p.paginator, p.setCursors(tx.Statement, schema, rows, more, true)
+}
+
+// setCursors signs the cursors of the pages around rows into the Paginator.
+func (p FilterParams) setCursors(stmt *gorm.Statement, schema FilterSchema, rows reflect.Value, hasNext, hasPrev bool) errors.ErrorModel {
+	if schema.Cursors == nil || rows.Len() == 0 {
+		return nil
+	}
+	sorts := p.Sorts
+	if p.cursor != nil {
+		sorts = p.cursor.Sorts
+	}
+	columns, paramErr := schema.keyColumns(sorts)
+	if paramErr != nil {
+		return paramErr.errorModel(p.language)
+	}
+	var next, prev string
+	if hasNext {
+		values, err := rowValues(stmt, columns, rows.Index(rows.Len()-1))
+		if err != nil {
+			return errors.DefaultServiceUnAvaialable.WithError(err)
+		}
+		next = schema.Cursors.sign(cursor{Sorts: sorts, Values: values})
+	}
+	if hasPrev {
+		values, err := rowValues(stmt, columns, rows.Index(0))
+		if err != nil {
+			return errors.DefaultServiceUnAvaialable.WithError(err)
+		}
+		prev = schema.Cursors.sign(cursor{Sorts: sorts, Values: values, Backward: true})
+	}
+	p.paginator.SetCursors(next, prev)
+	return nil
+}
+
+func rowValues(stmt *gorm.Statement, columns []keyColumn, row reflect.Value) ([]string, error) {
+	row = reflect.Indirect(row)
+	values := make([]string, 0, len(columns))
+	for _, c := range columns {
+		field := stmt.Schema.LookUpField(c.field.Column)
+		if field == nil {
+			return nil, fmt.Errorf("gateway: %s has no column %s", stmt.Schema.Name, c.field.Column)
+		}
+		value, _ := field.ValueOf(row)
+		formatted, ok := cursorValue(value)
+		if !ok {
+			return nil, fmt.Errorf("gateway: %s.%s is NULL, declare it Nullable to keep it out of cursor sorts", stmt.Schema.Name, c.field.Column)
+		}
+		values = append(values, formatted)
+	}
+	return values, nil
+}
+
+// cursorValue formats v to be parsed back by the FieldType of its field,
+// NULLs have no place in a keyset and are reported.
+func cursorValue(v any) (string, bool) {
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return "", false
+		}
+		v = rv.Elem().Interface()
+	}
+	if valuer, ok := v.(driver.Valuer); ok {
+		value, err := valuer.Value()
+		if err != nil {
+			return "", false
+		}
+		v = value
+	}
+	if v == nil {
+		return "", false
+	}
+	if t, ok := v.(time.Time); ok {
+		return t.Format(time.RFC3339Nano), true
+	}
+	return fmt.Sprint(v), true
+}
@@ -0,0 +1,192 @@
+package gateway
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	errors "github.com/haderianous/go-error"
+	"github.com/haderianous/go-logger/logger"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeRows answers every query of db with the next rows, counts with total,
+// and records the SQL.
+type fakeRows struct {
+	rows  [][]account
+	total int64
+	sql   []string
+	vars  [][]interface{}
+}
+
+func (f *fakeRows) open(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(dryRunDialector{}, &gorm.Config{})
+	assert.NoError(t, err)
+	err = db.Callback().Query().Replace("gorm:query", func(tx *gorm.DB) {
+		callbacks.BuildQuerySQL(tx)
+		if count, ok := tx.Statement.Dest.(*int64); ok {
+			*count, tx.RowsAffected = f.total, 1
+			return
+		}
+		f.sql = append(f.sql, tx.Statement.SQL.String())
+		f.vars = append(f.vars, tx.Statement.Vars)
+		reflect.ValueOf(tx.Statement.Dest).Elem().Set(reflect.ValueOf(f.rows[0]))
+		f.rows = f.rows[1:]
+	})
+	assert.NoError(t, err)
+	return db
+}
+
+func TestCursorSigner(t *testing.T) {
+	signer := NewCursorSigner([]byte("secret"))
+	token := signer.sign(cursor{Sorts: []Sort{{Key: "name", Value: "asc"}}, Values: []string{"ali", "7"}})
+	c, ok := signer.verify(token)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"ali", "7"}, c.Values)
+
+	payload, signature, _ := strings.Cut(token, ".")
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"v":["ali","8"]}`)) + "." + signature
+	for _, token := range []string{"", "x", forged, payload, token + "x"} {
+		_, ok = signer.verify(token)
+		assert.False(t, ok, token)
+	}
+	_, ok = NewCursorSigner([]byte("other")).verify(token)
+	assert.False(t, ok)
+}
+
+type accountsHandler struct {
+	db     *gorm.DB
+	schema FilterSchema
+}
+
+func (h *accountsHandler) Handle(req Request) (any, errors.ErrorModel) {
+	if err := req.BindFilters(); err != nil {
+		return nil, err
+	}
+	var accounts []account
+	if _, err := req.Filters().Find(h.db.Model(&account{}), h.schema, &accounts); err != nil {
+		return nil, err
+	}
+	return accounts, nil
+}
+
+func TestFilterParams_Find(t *testing.T) {
+	schema := FilterSchema{
+		Fields: map[string]FilterField{
+			"id":   {Column: "id", Type: IntField, Sortable: true},
+			"name": {Column: "name", Sortable: true},
+		},
+		UniqueKey: "id",
+		Cursors:   NewCursorSigner([]byte("secret")),
+	}
+	fake := &fakeRows{total: 5}
+	respond := NewResponder(i18n.NewBundle(language.English))
+	c := NewController(respond, logger.NewLogger(logger.WarnLevel, logger.JsonEncoding))
+	rg := NewServer(c).NewRouterGroup("api")
+	rg.Get("accounts", Filterable(schema), &accountsHandler{db: fake.open(t), schema: schema})
+
+	type page struct {
+		Data struct {
+			Total      int       `json:"total"`
+			NextCursor string    `json:"next_cursor"`
+			PrevCursor string    `json:"prev_cursor"`
+			Result     []account `json:"result"`
+		} `json:"data"`
+	}
+	serve := func(query string) (*httptest.ResponseRecorder, page) {
+		req, _ := http.NewRequest(http.MethodGet, "/api/accounts?"+query, nil)
+		req.Header.Set("Accept-Language", "en")
+		w := httptest.NewRecorder()
+		rg.ServeHttp(w, req)
+		var body page
+		_ = json.Unmarshal(w.Body.Bytes(), &body)
+		return w, body
+	}
+	rows := []account{{ID: 1, Name: "a"}, {ID: 2, Name: "b"}, {ID: 3, Name: "c"}, {ID: 4, Name: "d"}, {ID: 5, Name: "e"}}
+
+	fake.rows = [][]account{rows[0:2]}
+	w, first := serve("limit=2&sorts[0][k]=name")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `SELECT * FROM "accounts" ORDER BY "name","id" LIMIT 2`, fake.sql[0])
+	assert.Equal(t, 5, first.Data.Total)
+	assert.Equal(t, rows[0:2], first.Data.Result)
+	assert.NotEmpty(t, first.Data.NextCursor)
+	assert.Empty(t, first.Data.PrevCursor)
+
+	fake.rows = [][]account{rows[2:5]}
+	w, second := serve("limit=2&cursor=" + url.QueryEscape(first.Data.NextCursor))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `SELECT * FROM "accounts" WHERE ("name" > ? OR ("name" = ? AND "id" > ?)) ORDER BY "name","id" LIMIT 3`, fake.sql[1])
+	assert.Equal(t, []interface{}{"b", "b", int64(2)}, fake.vars[1])
+	assert.Equal(t, rows[2:4], second.Data.Result)
+	assert.NotEmpty(t, second.Data.NextCursor)
+	assert.NotEmpty(t, second.Data.PrevCursor)
+
+	fake.rows = [][]account{{rows[1], rows[0]}}
+	w, back := serve("limit=2&sorts[0][k]=name&cursor=" + url.QueryEscape(second.Data.PrevCursor))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `SELECT * FROM "accounts" WHERE ("name" < ? OR ("name" = ? AND "id" < ?)) ORDER BY "name" DESC,"id" DESC LIMIT 3`, fake.sql[2])
+	assert.Equal(t, rows[0:2], back.Data.Result)
+	assert.NotEmpty(t, back.Data.NextCursor)
+	assert.Empty(t, back.Data.PrevCursor)
+
+	w, _ = serve("cursor=" + url.QueryEscape(first.Data.NextCursor+"x"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "cursor is invalid.")
+
+	w, _ = serve("sorts[0][k]=id&cursor=" + url.QueryEscape(first.Data.NextCursor))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "cursor was made for other sorts.")
+	assert.Len(t, fake.sql, 3)
+}
+
+func TestFilterSchema_cursorKeys(t *testing.T) {
+	signer := NewCursorSigner([]byte("secret"))
+	respond := NewResponder(i18n.NewBundle(language.English))
+	c := NewController(respond, logger.NewLogger(logger.WarnLevel, logger.JsonEncoding))
+	rg := NewServer(c).NewRouterGroup("api")
+	noKey := FilterSchema{Fields: map[string]FilterField{"name": {Column: "name", Sortable: true}}, Cursors: signer}
+	assert.PanicsWithValue(t, "gateway: a FilterSchema with Cursors needs a UniqueKey, route GET accounts", func() {
+		rg.Get("accounts", Filterable(noKey), NewHelloHandler())
+	})
+
+	db, err := gorm.Open(dryRunDialector{}, &gorm.Config{DryRun: true})
+	assert.NoError(t, err)
+	var accounts []account
+	_, e := FilterParams{cursor: &cursor{}}.Find(db.Model(&account{}), noKey, &accounts)
+	if assert.NotNil(t, e) {
+		assert.True(t, e.Is(errors.TypeUnAvailable))
+	}
+
+	schema := FilterSchema{
+		Fields: map[string]FilterField{
+			"id":      {Column: "id", Type: IntField, Sortable: true},
+			"closing": {Column: "closed_at", Type: TimeField, Sortable: true, Nullable: true},
+		},
+		UniqueKey: "id",
+		Cursors:   signer,
+	}
+	_, _, errs := schema.bind(nil, []Sort{{Key: "closing", Value: "asc"}})
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "NullableCursorSort", errs[0].messageId)
+	}
+	schema.DefaultSort = []Sort{{Key: "closing", Value: "asc"}}
+	assert.Error(t, schema.validate())
+
+	for _, v := range []any{nil, (*string)(nil), sql.NullString{}, &sql.NullInt64{}} {
+		_, ok := cursorValue(v)
+		assert.False(t, ok, v)
+	}
+	value, ok := cursorValue(sql.NullString{String: "ali", Valid: true})
+	assert.True(t, ok)
+	assert.Equal(t, "ali", value)
+}
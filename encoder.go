@@ -0,0 +1,657 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/ugorji/go/codec"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+	"io"
+	"mime"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Encoder writes response bodies in, and reads request bodies from, one
+// format.
+type Encoder interface {
+	// MediaTypes lists the media types handled by the encoder, the first one
+	// is written as Content-Type.
+	MediaTypes() []string
+	// Supports reports whether v can be encoded, the Responder falls back to
+	// the bare handler result when the enveloped body is not supported.
+	Supports(v any) bool
+	Encode(w io.Writer, v any) error
+	Decode(r io.Reader, v any) error
+}
+
+type jsonEncoder struct{}
+
+func JSONEncoder() Encoder {
+	return jsonEncoder{}
+}
+
+func (jsonEncoder) MediaTypes() []string {
+	return []string{"application/json"}
+}
+
+func (jsonEncoder) Supports(any) bool {
+	return true
+}
+
+func (jsonEncoder) Encode(w io.Writer, v any) error {
+	b, err := marshalJSON(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// Decode reads v as gin's JSON binding does, proto messages are read with
+// protojson.
+func (jsonEncoder) Decode(r io.Reader, v any) error {
+	if m, ok := v.(proto.Message); ok {
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		return protojson.Unmarshal(b, m)
+	}
+	return decodeJSON(r, v)
+}
+
+// decodeJSON honours binding.EnableDecoderUseNumber and
+// binding.EnableDecoderDisallowUnknownFields.
+func decodeJSON(r io.Reader, v any) error {
+	dec := json.NewDecoder(r)
+	if binding.EnableDecoderUseNumber {
+		dec.UseNumber()
+	}
+	if binding.EnableDecoderDisallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	return dec.Decode(v)
+}
+
+// marshalJSON writes proto messages with protojson and anything else with
+// encoding/json.
+func marshalJSON(v any) ([]byte, error) {
+	if m, ok := v.(proto.Message); ok {
+		return protojson.Marshal(m)
+	}
+	return json.Marshal(v)
+}
+
+// protoMessage is a proto message nested in a body, it is written with
+// protojson whatever the encoding/json user.
+type protoMessage struct {
+	proto.Message
+}
+
+func (m protoMessage) MarshalJSON() ([]byte, error) {
+	return protojson.Marshal(m.Message)
+}
+
+// withProtoJSON wraps result, or the items of a result slice, when they are
+// proto messages so envelopes write them with protojson.
+func withProtoJSON(result any) any {
+	if m, ok := result.(proto.Message); ok {
+		return protoMessage{m}
+	}
+	v := reflect.ValueOf(result)
+	if v.Kind() != reflect.Slice || !v.Type().Elem().Implements(protoMessageType) {
+		return result
+	}
+	items := make([]any, v.Len())
+	for i := range items {
+		items[i] = protoMessage{v.Index(i).Interface().(proto.Message)}
+	}
+	return items
+}
+
+var protoMessageType = reflect.TypeOf((*proto.Message)(nil)).Elem()
+
+type xmlEncoder struct{}
+
+// XMLEncoder writes the JSON form of a body as XML, so field names match the
+// json ones, characters not allowed in XML names are replaced by _. Request
+// bodies are read back the same way, by the json names of their fields.
+func XMLEncoder() Encoder {
+	return xmlEncoder{}
+}
+
+func (xmlEncoder) MediaTypes() []string {
+	return []string{"application/xml", "text/xml"}
+}
+
+func (xmlEncoder) Supports(any) bool {
+	return true
+}
+
+func (xmlEncoder) Encode(w io.Writer, v any) error {
+	tree, err := jsonTree(v)
+	if err != nil {
+		return err
+	}
+	if _, err = io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	if err = encodeXML(enc, "response", tree); err != nil {
+		return err
+	}
+	return enc.Flush()
+}
+
+func (xmlEncoder) Decode(r io.Reader, v any) error {
+	root, err := parseXML(xml.NewDecoder(r))
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(root.value(reflect.TypeOf(v)))
+	if err != nil {
+		return err
+	}
+	return decodeJSON(bytes.NewReader(b), v)
+}
+
+type yamlEncoder struct{}
+
+// YAMLEncoder writes the JSON form of a body as YAML.
+func YAMLEncoder() Encoder {
+	return yamlEncoder{}
+}
+
+func (yamlEncoder) MediaTypes() []string {
+	return []string{"application/yaml", "application/x-yaml", "text/yaml"}
+}
+
+func (yamlEncoder) Supports(any) bool {
+	return true
+}
+
+func (yamlEncoder) Encode(w io.Writer, v any) error {
+	tree, err := jsonTree(v)
+	if err != nil {
+		return err
+	}
+	enc := yaml.NewEncoder(w)
+	if err = enc.Encode(tree); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// Decode reads the YAML into a tree and binds its JSON form, so the json tags
+// of the target apply as they do for the other formats.
+func (yamlEncoder) Decode(r io.Reader, v any) error {
+	var tree any
+	if err := yaml.NewDecoder(r).Decode(&tree); err != nil {
+		return err
+	}
+	b, err := json.Marshal(yamlTree(tree))
+	if err != nil {
+		return err
+	}
+	return jsonEncoder{}.Decode(bytes.NewReader(b), v)
+}
+
+// yamlTree turns the maps with non string keys yaml gives into ones JSON can
+// hold.
+func yamlTree(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, item := range t {
+			t[k] = yamlTree(item)
+		}
+	case map[any]any:
+		m := make(map[string]any, len(t))
+		for k, item := range t {
+			m[fmt.Sprint(k)] = yamlTree(item)
+		}
+		return m
+	case []any:
+		for i, item := range t {
+			t[i] = yamlTree(item)
+		}
+	}
+	return v
+}
+
+type msgPackEncoder struct {
+	handle *codec.MsgpackHandle
+}
+
+// MsgPackEncoder writes the JSON form of a body as MessagePack.
+func MsgPackEncoder() Encoder {
+	handle := &codec.MsgpackHandle{}
+	handle.RawToString = true
+	handle.WriteExt = true
+	return msgPackEncoder{handle: handle}
+}
+
+func (msgPackEncoder) MediaTypes() []string {
+	return []string{"application/msgpack", "application/x-msgpack", "application/vnd.msgpack"}
+}
+
+func (msgPackEncoder) Supports(any) bool {
+	return true
+}
+
+func (e msgPackEncoder) Encode(w io.Writer, v any) error {
+	tree, err := jsonTree(v)
+	if err != nil {
+		return err
+	}
+	return codec.NewEncoder(w, e.handle).Encode(tree)
+}
+
+func (e msgPackEncoder) Decode(r io.Reader, v any) error {
+	return codec.NewDecoder(r, e.handle).Decode(v)
+}
+
+type protobufEncoder struct{}
+
+// ProtobufEncoder only handles proto messages, handlers returning one are
+// answered with the bare message since no envelope is a proto message.
+func ProtobufEncoder() Encoder {
+	return protobufEncoder{}
+}
+
+func (protobufEncoder) MediaTypes() []string {
+	return []string{"application/x-protobuf", "application/protobuf", "application/vnd.google.protobuf"}
+}
+
+func (protobufEncoder) Supports(v any) bool {
+	_, ok := v.(proto.Message)
+	return ok
+}
+
+func (protobufEncoder) Encode(w io.Writer, v any) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("gateway: %T is not a proto message", v)
+	}
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func (protobufEncoder) Decode(r io.Reader, v any) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("gateway: %T is not a proto message", v)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(b, m)
+}
+
+// jsonTree turns v into maps, slices and scalars by a round trip through
+// JSON.
+func jsonTree(v any) (any, error) {
+	b, err := marshalJSON(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var tree any
+	if err = dec.Decode(&tree); err != nil {
+		return nil, err
+	}
+	return numbers(tree), nil
+}
+
+// numbers replaces json.Number by int64 or float64 so every format writes
+// numbers as numbers.
+func numbers(v any) any {
+	switch t := v.(type) {
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i
+		}
+		f, _ := t.Float64()
+		return f
+	case map[string]any:
+		for k, item := range t {
+			t[k] = numbers(item)
+		}
+	case []any:
+		for i, item := range t {
+			t[i] = numbers(item)
+		}
+	}
+	return v
+}
+
+func encodeXML(enc *xml.Encoder, name string, v any) error {
+	start := xml.StartElement{Name: xml.Name{Local: xmlName(name)}}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	switch t := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := encodeXML(enc, k, t[k]); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, item := range t {
+			if err := encodeXML(enc, "item", item); err != nil {
+				return err
+			}
+		}
+	case nil:
+	case string:
+		if err := enc.EncodeToken(xml.CharData(t)); err != nil {
+			return err
+		}
+	default:
+		if err := enc.EncodeToken(xml.CharData(fmt.Sprint(t))); err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// xmlName replaces the characters of name not allowed in an XML name by _,
+// names cannot start with a digit, - or . either.
+func xmlName(name string) string {
+	b := []rune(name)
+	for i, r := range b {
+		letter := unicode.IsLetter(r) || r == '_'
+		if !letter && (i == 0 || !unicode.IsDigit(r) && r != '-' && r != '.') {
+			b[i] = '_'
+		}
+	}
+	if len(b) == 0 {
+		return "_"
+	}
+	return string(b)
+}
+
+// xmlNode is an element of a request body, by the xmlName of its children.
+type xmlNode struct {
+	text     string
+	children map[string][]*xmlNode
+}
+
+func parseXML(dec *xml.Decoder) (*xmlNode, error) {
+	stack := []*xmlNode{{children: map[string][]*xmlNode{}}}
+	for {
+		token, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		top := stack[len(stack)-1]
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{children: map[string][]*xmlNode{}}
+			top.children[t.Name.Local] = append(top.children[t.Name.Local], node)
+			stack = append(stack, node)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			top.text += string(t)
+		}
+	}
+	for _, root := range stack[0].children {
+		return root[0], nil
+	}
+	return nil, io.EOF
+}
+
+// value converts n to the JSON form of t, the text of elements is parsed as
+// the scalar type of their field.
+func (n *xmlNode) value(t reflect.Type) any {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t != timeType && !reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		switch t.Kind() {
+		case reflect.Struct:
+			object := map[string]any{}
+			n.fields(t, object)
+			return object
+		case reflect.Map:
+			object := map[string]any{}
+			for name, nodes := range n.children {
+				object[name] = nodes[0].value(t.Elem())
+			}
+			return object
+		case reflect.Slice, reflect.Array:
+			if t.Elem().Kind() == reflect.Uint8 {
+				break
+			}
+			items := []any{}
+			for _, item := range n.children["item"] {
+				items = append(items, item.value(t.Elem()))
+			}
+			return items
+		case reflect.Interface:
+			if len(n.children) > 0 {
+				return n.value(reflect.TypeOf(map[string]any{}))
+			}
+		}
+	}
+	text := strings.TrimSpace(n.text)
+	switch t.Kind() {
+	case reflect.Bool:
+		if v, err := strconv.ParseBool(text); err == nil {
+			return v
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if _, err := strconv.ParseFloat(text, 64); err == nil {
+			return json.Number(text)
+		}
+	}
+	return n.text
+}
+
+// fields sets the fields of struct t found among the children of n into
+// object, embedded structs without a json name are flattened.
+func (n *xmlNode) fields(t reflect.Type, object map[string]any) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		name := tagName(tag)
+		if f.Anonymous && tag == "" {
+			ft := f.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				n.fields(ft, object)
+				continue
+			}
+		}
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if nodes, ok := n.children[xmlName(name)]; ok {
+			object[name] = nodes[0].value(f.Type)
+		}
+	}
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+type mediaRange struct {
+	typ, subtype string
+	q            float64
+}
+
+// parseAccept returns the media ranges of an Accept header, most preferred
+// first. An empty header accepts anything.
+func parseAccept(header string) []mediaRange {
+	if strings.TrimSpace(header) == "" {
+		return []mediaRange{{typ: "*", subtype: "*", q: 1}}
+	}
+	var ranges []mediaRange
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		typ, subtype, _ := strings.Cut(mediaType, "/")
+		r := mediaRange{typ: typ, subtype: subtype, q: 1}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil {
+			r.q = q
+		}
+		ranges = append(ranges, r)
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].q != ranges[j].q {
+			return ranges[i].q > ranges[j].q
+		}
+		return ranges[i].specificity() > ranges[j].specificity()
+	})
+	return ranges
+}
+
+func (r mediaRange) specificity() int {
+	switch {
+	case r.typ == "*":
+		return 0
+	case r.subtype == "*":
+		return 1
+	}
+	return 2
+}
+
+// matches reports whether mediaType falls in the range, a structured syntax
+// suffix such as application/problem+json matches application/json.
+func (r mediaRange) matches(mediaType string) bool {
+	typ, subtype, _ := strings.Cut(mediaType, "/")
+	if r.typ == "*" {
+		return true
+	}
+	if r.typ != typ {
+		return false
+	}
+	if r.subtype == "*" || r.subtype == subtype {
+		return true
+	}
+	_, suffix, ok := strings.Cut(r.subtype, "+")
+	return ok && suffix == subtype
+}
+
+// excluded reports whether a q=0 range rules mediaType out.
+func excluded(ranges []mediaRange, mediaType string) bool {
+	for _, r := range ranges {
+		if r.q == 0 && r.specificity() == 2 && r.matches(mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiate picks the encoder of the most preferred acceptable media type
+// able to encode body, or result when body is not supported.
+func negotiate(accept string, encoders []Encoder, body, result any) (Encoder, any, bool) {
+	ranges := parseAccept(accept)
+	for _, r := range ranges {
+		if r.q == 0 {
+			continue
+		}
+		for _, e := range encoders {
+			for _, mediaType := range e.MediaTypes() {
+				if !r.matches(mediaType) || excluded(ranges, mediaType) {
+					continue
+				}
+				if e.Supports(body) {
+					return e, body, true
+				}
+				if result != nil && e.Supports(result) {
+					return e, result, true
+				}
+			}
+		}
+	}
+	return nil, nil, false
+}
+
+// encoderFor returns the encoder reading request bodies of contentType.
+func encoderFor(contentType string, encoders []Encoder) (Encoder, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+	typ, subtype, _ := strings.Cut(mediaType, "/")
+	r := mediaRange{typ: typ, subtype: subtype}
+	for _, e := range encoders {
+		for _, m := range e.MediaTypes() {
+			if r.matches(m) {
+				return e, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// contentType is the Content-Type of a body written by e, the envelope one
+// wins when it belongs to the same format, e.g. application/problem+json.
+func contentType(e Encoder, envelope string) string {
+	mediaType := mediaTypeOf(e, envelope)
+	if textual(mediaType) {
+		return mediaType + "; charset=utf-8"
+	}
+	return mediaType
+}
+
+// mediaTypeOf returns the media type e writes a body of an envelope with the
+// given content type as, the envelope one when it is of e's format.
+func mediaTypeOf(e Encoder, envelope string) string {
+	mediaType := e.MediaTypes()[0]
+	if envelope != "" {
+		typ, subtype, _ := strings.Cut(envelope, "/")
+		if (mediaRange{typ: typ, subtype: subtype}).matches(mediaType) {
+			mediaType = envelope
+		}
+	}
+	return mediaType
+}
+
+func textual(mediaType string) bool {
+	typ, subtype, _ := strings.Cut(mediaType, "/")
+	if typ == "text" {
+		return true
+	}
+	if i := strings.LastIndex(subtype, "+"); i >= 0 {
+		subtype = subtype[i+1:]
+	}
+	switch subtype {
+	case "json", "xml", "yaml", "x-yaml":
+		return true
+	}
+	return false
+}
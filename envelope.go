@@ -0,0 +1,262 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	errors "github.com/haderianous/go-error"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Envelope shapes the bodies written by the Responder. Both methods return
+// the body to render and its content type, an empty one meaning
+// application/json.
+type Envelope interface {
+	Success(req Request, result any) (body any, contentType string)
+	Failure(req Request, status int, err errors.ErrorModel) (body any, contentType string)
+}
+
+// DocumentedEnvelope is an Envelope describing its bodies to OpenAPI, the
+// bodies of other envelopes are documented as free form.
+type DocumentedEnvelope interface {
+	Envelope
+	// SuccessSchema wraps the schema of a result, a single object when
+	// object is true or an item of a list otherwise. The content type is the
+	// one Success returns.
+	SuccessSchema(result map[string]any, object bool) (schema map[string]any, contentType string)
+	FailureSchema() (schema map[string]any, contentType string)
+}
+
+type defaultEnvelope struct{}
+
+// DefaultEnvelope wraps results in Response and writes errors as they are.
+func DefaultEnvelope() Envelope {
+	return defaultEnvelope{}
+}
+
+func (defaultEnvelope) Success(req Request, result any) (any, string) {
+	version := routeVersion(req)
+	representedAt := time.Now().Format("2006-01-02 15:04:05")
+	if isObject(req, result) {
+		response := ObjectResponse{
+			Message:       req.GetMessage(),
+			Version:       version,
+			RepresentedAt: representedAt,
+		}
+		response.Data.Result = result
+		return response, ""
+	}
+
+	response := Response{
+		Message:       req.GetMessage(),
+		Version:       version,
+		RepresentedAt: representedAt,
+	}
+	response.Data.Total = req.Paginator().Total()
+	response.Data.PerPage = req.Paginator().PerPage()
+	response.Data.NextCursor = req.Paginator().NextCursor()
+	response.Data.PrevCursor = req.Paginator().PrevCursor()
+
+	if result == nil {
+		response.Data.Result = []any{}
+	} else if reflect.TypeOf(result).Kind() == reflect.Slice {
+		response.Data.Result = result
+	} else {
+		response.Data.Result = []any{result}
+	}
+	return response, ""
+}
+
+func (defaultEnvelope) Failure(req Request, status int, err errors.ErrorModel) (any, string) {
+	return withVersion(err, routeVersion(req)), ""
+}
+
+// routeVersion is the version of the route serving req, defaultVersion for
+// unversioned routes.
+func routeVersion(req Request) string {
+	if version := req.Route().Version; version != "" {
+		return version
+	}
+	return defaultVersion
+}
+
+// withVersion renders err with version in place of the one go-error always
+// sets.
+func withVersion(err errors.ErrorModel, version string) any {
+	b, e := json.Marshal(err)
+	if e != nil {
+		return err
+	}
+	var body map[string]any
+	if e = json.Unmarshal(b, &body); e != nil {
+		return err
+	}
+	body["version"] = version
+	return body
+}
+
+type rawEnvelope struct{}
+
+// RawEnvelope writes results without any wrapping, errors are written as
+// they are.
+func RawEnvelope() Envelope {
+	return rawEnvelope{}
+}
+
+func (rawEnvelope) Success(req Request, result any) (any, string) {
+	return result, ""
+}
+
+func (rawEnvelope) Failure(req Request, status int, err errors.ErrorModel) (any, string) {
+	return err, ""
+}
+
+const jsonAPIContentType = "application/vnd.api+json"
+
+type jsonAPIEnvelope struct{}
+
+// JSONAPIEnvelope follows the JSON:API document structure, results go to
+// data as resource objects, pagination to meta and errors to errors, one per
+// invalid field.
+func JSONAPIEnvelope() Envelope {
+	return jsonAPIEnvelope{}
+}
+
+// Resource names the resource object a result is written as by
+// JSONAPIEnvelope. Results that are not one get the lowercased name of their
+// type and the value of their id field.
+type Resource interface {
+	ResourceType() string
+	ResourceID() string
+}
+
+func (jsonAPIEnvelope) Success(req Request, result any) (any, string) {
+	meta := map[string]any{}
+	var data any
+	if isObject(req, result) {
+		if result != nil {
+			data = resourceObject(result)
+		}
+	} else {
+		list := []any{}
+		if result != nil {
+			items := reflect.ValueOf(result)
+			if items.Kind() != reflect.Slice {
+				items = reflect.ValueOf([]any{result})
+			}
+			for i := 0; i < items.Len(); i++ {
+				list = append(list, resourceObject(items.Index(i).Interface()))
+			}
+		}
+		data = list
+		meta["total"] = req.Paginator().Total()
+		meta["per_page"] = req.Paginator().PerPage()
+		if next := req.Paginator().NextCursor(); next != "" {
+			meta["next_cursor"] = next
+		}
+		if prev := req.Paginator().PrevCursor(); prev != "" {
+			meta["prev_cursor"] = prev
+		}
+	}
+	if message := req.GetMessage(); message != "" {
+		meta["message"] = message
+	}
+	if version := req.Route().Version; version != "" {
+		meta["version"] = version
+	}
+	return map[string]any{"data": data, "meta": meta}, jsonAPIContentType
+}
+
+// resourceObject splits the JSON form of item into the type, id and
+// attributes of a resource object. Items not encoded as JSON objects are
+// kept as they are.
+func resourceObject(item any) any {
+	b, err := json.Marshal(item)
+	if err != nil {
+		return item
+	}
+	var attributes map[string]any
+	if err = json.Unmarshal(b, &attributes); err != nil || attributes == nil {
+		return item
+	}
+	if m, ok := item.(protoMessage); ok {
+		item = m.Message
+	}
+	object := map[string]any{}
+	if r, ok := item.(Resource); ok {
+		object["type"] = r.ResourceType()
+		object["id"] = r.ResourceID()
+	} else {
+		object["type"] = strings.ToLower(reflect.Indirect(reflect.ValueOf(item)).Type().Name())
+		switch id := attributes["id"].(type) {
+		case string:
+			object["id"] = id
+		case float64:
+			object["id"] = strconv.FormatFloat(id, 'f', -1, 64)
+		}
+	}
+	// type and id are not allowed among the attributes
+	delete(attributes, "type")
+	delete(attributes, "id")
+	object["attributes"] = attributes
+	return object
+}
+
+func (jsonAPIEnvelope) Failure(req Request, status int, err errors.ErrorModel) (any, string) {
+	base := map[string]any{
+		"status": strconv.Itoa(status),
+		"code":   string(err.Type()),
+		"title":  err.ErrorText(),
+		"detail": err.Message(),
+	}
+	var list []any
+	for _, e := range err.Errors() {
+		item := make(map[string]any, len(base)+1)
+		for k, v := range base {
+			item[k] = v
+		}
+		if field, ok := e["field"]; ok {
+			item["source"] = map[string]any{"pointer": "/data/attributes/" + fmt.Sprint(field)}
+		}
+		if detail, ok := e["error"]; ok {
+			item["detail"] = fmt.Sprint(detail)
+		}
+		list = append(list, item)
+	}
+	if len(list) == 0 {
+		list = append(list, base)
+	}
+	return map[string]any{"errors": list}, jsonAPIContentType
+}
+
+const problemContentType = "application/problem+json"
+
+type problemEnvelope struct {
+	defaultEnvelope
+}
+
+// ProblemEnvelope writes errors as RFC 7807 problem details, results keep
+// the default envelope.
+func ProblemEnvelope() Envelope {
+	return problemEnvelope{}
+}
+
+func (problemEnvelope) Failure(req Request, status int, err errors.ErrorModel) (any, string) {
+	problem := map[string]any{
+		"type":   "about:blank",
+		"title":  http.StatusText(status),
+		"status": status,
+		"detail": err.Message(),
+		"code":   string(err.Type()),
+	}
+	if req.Request() != nil {
+		problem["instance"] = req.Request().URL.Path
+	}
+	if fields := err.Errors(); len(fields) > 0 {
+		problem["errors"] = fields
+	}
+	return problem, problemContentType
+}
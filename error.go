@@ -5,6 +5,56 @@ import (
 	"net/http"
 )
 
+const (
+	TypeEntityTooLarge errors.Type = "ENTITY_TOO_LARGE"
+	TypeTimeout        errors.Type = "TIMEOUT"
+	TypeNotAllowed     errors.Type = "NOT_ALLOWED"
+	TypeNotAcceptable  errors.Type = "NOT_ACCEPTABLE"
+	TypeBadGateway     errors.Type = "BAD_GATEWAY"
+)
+
+var DefaultEntityTooLargeError = errors.New().WithType(TypeEntityTooLarge).
+	WithMessageId("EntityTooLargeError").
+	WithErrorId("InvalidData").
+	WithMessage("Request body is too large.").
+	WithErrorText("Invalid given data").SetDefaults(true)
+
+var DefaultTimeoutError = errors.New().WithType(TypeTimeout).
+	WithMessageId("TimeoutError").
+	WithErrorId("HttpError").
+	WithMessage("The request took too long to process. Please try again.").
+	WithErrorText("Internal Server Error").SetDefaults(true)
+
+var DefaultBadGatewayError = errors.New().WithType(TypeBadGateway).
+	WithMessageId("BadGatewayError").
+	WithErrorId("HttpError").
+	WithMessage("The upstream service could not be reached.").
+	WithErrorText("Bad gateway").SetDefaults(true)
+
+var DefaultGatewayTimeoutError = errors.New().WithType(TypeTimeout).
+	WithMessageId("GatewayTimeoutError").
+	WithErrorId("HttpError").
+	WithMessage("The upstream service took too long to respond.").
+	WithErrorText("Gateway timeout").SetDefaults(true)
+
+var DefaultMethodNotAllowedError = errors.New().WithType(TypeNotAllowed).
+	WithMessageId("MethodNotAllowedError").
+	WithErrorId("InvalidRequest").
+	WithMessage("The request method is not allowed for this route.").
+	WithErrorText("Invalid request").SetDefaults(true)
+
+var DefaultNotAcceptableError = errors.New().WithType(TypeNotAcceptable).
+	WithMessageId("NotAcceptableError").
+	WithErrorId("InvalidRequest").
+	WithMessage("None of the acceptable response formats is available.").
+	WithErrorText("Invalid request").SetDefaults(true)
+
+var DefaultInvalidQueryError = errors.New().WithType(errors.TypeBadRequest).
+	WithMessageId("InvalidQueryError").
+	WithErrorId("InvalidRequest").
+	WithMessage("The query parameters are malformed.").
+	WithErrorText("Invalid request").SetDefaults(true)
+
 func getStatusCodeByError(typ errors.Type) int {
 	switch typ {
 	case errors.TypeUnProcessable:
@@ -25,6 +75,16 @@ func getStatusCodeByError(typ errors.Type) int {
 		return http.StatusConflict
 	case errors.TypeAccepted:
 		return http.StatusAccepted
+	case TypeEntityTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case TypeTimeout:
+		return http.StatusGatewayTimeout
+	case TypeNotAllowed:
+		return http.StatusMethodNotAllowed
+	case TypeNotAcceptable:
+		return http.StatusNotAcceptable
+	case TypeBadGateway:
+		return http.StatusBadGateway
 	}
 	return http.StatusInternalServerError
 }
@@ -1,18 +1,43 @@
 package gateway
 
+import (
+	"fmt"
+	errors "github.com/haderianous/go-error"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
 type Operation string
 
 const (
-	Eq    Operation = "eq"
-	Ct    Operation = "ct"
-	Bt    Operation = "bt"
-	NotEq Operation = "neq"
+	Eq         Operation = "eq"
+	Ct         Operation = "ct"
+	Bt         Operation = "bt"
+	NotEq      Operation = "neq"
+	In         Operation = "in"
+	NotIn      Operation = "nin"
+	Gt         Operation = "gt"
+	Gte        Operation = "gte"
+	Lt         Operation = "lt"
+	Lte        Operation = "lte"
+	StartsWith Operation = "sw"
+	EndsWith   Operation = "ew"
+	IsNull     Operation = "null"
+	NotNull    Operation = "notnull"
 )
 
+// Operations lists every supported Operation.
+var Operations = []Operation{Eq, NotEq, Ct, Bt, In, NotIn, Gt, Gte, Lt, Lte, StartsWith, EndsWith, IsNull, NotNull}
+
 type Filter struct {
 	Key   string        `json:"k"`
 	Value []interface{} `json:"v"`
 	Op    Operation     `json:"op"`
+	// Group names the OR group of the filter, see FilterParams.Groups.
+	Group string `json:"g,omitempty"`
 }
 
 type Sort struct {
@@ -25,8 +50,38 @@ type FilterParams struct {
 	Sorts   []Sort   `json:"sorts"`
 	Page    int      `json:"page"`
 	Limit   int      `json:"limit"`
+	// Cursor is the cursor query parameter of keyset pagination, see Find.
+	Cursor string `json:"cursor,omitempty"`
+	// set by BindFilters for Apply
+	paginator Paginator
+	language  Language
+	cursor    *cursor
 }
 
+// Groups returns the filters in conjunctive form: every group must match and
+// a group matches when any of its filters does. Filters sharing a Group form
+// one group, ungrouped filters are groups of their own.
+func (p FilterParams) Groups() [][]Filter {
+	var groups [][]Filter
+	index := map[string]int{}
+	for _, f := range p.Filters {
+		if f.Group == "" {
+			groups = append(groups, []Filter{f})
+			continue
+		}
+		i, ok := index[f.Group]
+		if !ok {
+			i = len(groups)
+			index[f.Group] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], f)
+	}
+	return groups
+}
+
+// ToSql returns the SQL operator of op, or an empty string for unknown
+// operations.
 func (op Operation) ToSql() string {
 	switch op {
 	case Bt:
@@ -35,9 +90,231 @@ func (op Operation) ToSql() string {
 		return "="
 	case NotEq:
 		return "!="
-	case Ct:
+	case Ct, StartsWith, EndsWith:
 		return "like"
+	case In:
+		return "in"
+	case NotIn:
+		return "not in"
+	case Gt:
+		return ">"
+	case Gte:
+		return ">="
+	case Lt:
+		return "<"
+	case Lte:
+		return "<="
+	case IsNull:
+		return "is null"
+	case NotNull:
+		return "is not null"
 	default:
-		return "="
+		return ""
+	}
+}
+
+// Valid reports whether op is one of Operations.
+func (op Operation) Valid() bool {
+	return op.ToSql() != ""
+}
+
+// arity returns the least and most values op takes, -1 meaning no limit.
+func (op Operation) arity() (int, int) {
+	switch op {
+	case Bt:
+		return 2, 2
+	case In, NotIn:
+		return 1, -1
+	case IsNull, NotNull:
+		return 0, 0
+	}
+	return 1, 1
+}
+
+var filterParamPattern = regexp.MustCompile(`^(filters|sorts)\[(\d+)\]\[([a-z]+)\]$`)
+
+// paramError describes the query parameter that made BindFilters fail,
+// malformed ones are syntax errors answered with 400 and the rest 422.
+type paramError struct {
+	param     string
+	messageId string
+	message   string
+	malformed bool
+}
+
+type filterEntry struct {
+	filter        Filter
+	hasKey, hasOp bool
+	hasGroup      bool
+	opParam       string
+}
+
+type sortEntry struct {
+	sort             Sort
+	hasKey, hasValue bool
+}
+
+// parseFilterParams reads filters[i][k|op|v|g] and sorts[i][k|v] out of a
+// raw query. Indexes only order the entries, they need not be contiguous, and
+// v may be repeated to give a filter several values.
+func parseFilterParams(rawQuery string) ([]Filter, []Sort, *paramError) {
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, nil, malformedParam("query")
+	}
+	params := make([]string, 0, len(query))
+	for param := range query {
+		params = append(params, param)
+	}
+	sort.Strings(params)
+
+	filters := map[int]*filterEntry{}
+	sorts := map[int]*sortEntry{}
+	for _, param := range params {
+		if !strings.HasPrefix(param, "filters[") && !strings.HasPrefix(param, "sorts[") {
+			continue
+		}
+		m := filterParamPattern.FindStringSubmatch(param)
+		if m == nil {
+			return nil, nil, malformedParam(param)
+		}
+		index, err := strconv.Atoi(m[2])
+		if err != nil {
+			return nil, nil, malformedParam(param)
+		}
+		values := query[param]
+		if m[1] == "filters" {
+			entry, ok := filters[index]
+			if !ok {
+				entry = &filterEntry{}
+				filters[index] = entry
+			}
+			switch m[3] {
+			case "k":
+				if len(values) > 1 || entry.hasKey {
+					return nil, nil, repeatedParam(param)
+				}
+				entry.filter.Key, entry.hasKey = values[0], true
+			case "op":
+				if len(values) > 1 || entry.hasOp {
+					return nil, nil, repeatedParam(param)
+				}
+				entry.filter.Op, entry.hasOp, entry.opParam = Operation(values[0]), true, param
+			case "g":
+				if len(values) > 1 || entry.hasGroup {
+					return nil, nil, repeatedParam(param)
+				}
+				entry.filter.Group, entry.hasGroup = values[0], true
+			case "v":
+				for _, v := range values {
+					entry.filter.Value = append(entry.filter.Value, v)
+				}
+			default:
+				return nil, nil, malformedParam(param)
+			}
+			continue
+		}
+
+		entry, ok := sorts[index]
+		if !ok {
+			entry = &sortEntry{}
+			sorts[index] = entry
+		}
+		if len(values) > 1 || (m[3] == "k" && entry.hasKey) || (m[3] == "v" && entry.hasValue) {
+			return nil, nil, repeatedParam(param)
+		}
+		switch m[3] {
+		case "k":
+			entry.sort.Key, entry.hasKey = values[0], true
+		case "v":
+			direction := strings.ToLower(values[0])
+			if direction != "asc" && direction != "desc" {
+				return nil, nil, &paramError{param: param, messageId: "InvalidSortDirection", message: "{{.Param}} must be asc or desc."}
+			}
+			entry.sort.Value, entry.hasValue = direction, true
+		default:
+			return nil, nil, malformedParam(param)
+		}
+	}
+
+	parsedFilters := make([]Filter, 0, len(filters))
+	for _, index := range sortedIndexes(filters) {
+		entry := filters[index]
+		if !entry.hasKey || entry.filter.Key == "" {
+			return nil, nil, requiredParam(fmt.Sprintf("filters[%d][k]", index))
+		}
+		if entry.filter.Op == "" {
+			entry.filter.Op = Eq
+		}
+		if !entry.filter.Op.Valid() {
+			return nil, nil, &paramError{param: entry.opParam, messageId: "UnknownFilterOperation", message: "{{.Param}} is not a supported operation."}
+		}
+		least, most := entry.filter.Op.arity()
+		if n := len(entry.filter.Value); n < least || (most >= 0 && n > most) {
+			return nil, nil, &paramError{param: fmt.Sprintf("filters[%d][v]", index), messageId: "InvalidFilterValues", message: "{{.Param}} has the wrong number of values for the operation."}
+		}
+		parsedFilters = append(parsedFilters, entry.filter)
+	}
+	parsedSorts := make([]Sort, 0, len(sorts))
+	for _, index := range sortedIndexes(sorts) {
+		entry := sorts[index]
+		if !entry.hasKey || entry.sort.Key == "" {
+			return nil, nil, requiredParam(fmt.Sprintf("sorts[%d][k]", index))
+		}
+		if !entry.hasValue {
+			entry.sort.Value = "asc"
+		}
+		parsedSorts = append(parsedSorts, entry.sort)
+	}
+	return parsedFilters, parsedSorts, nil
+}
+
+func sortedIndexes[T any](entries map[int]T) []int {
+	indexes := make([]int, 0, len(entries))
+	for index := range entries {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+func malformedParam(param string) *paramError {
+	return &paramError{param: param, messageId: "MalformedQueryParam", message: "{{.Param}} is malformed.", malformed: true}
+}
+
+func repeatedParam(param string) *paramError {
+	return &paramError{param: param, messageId: "RepeatedQueryParam", message: "{{.Param}} must be given once."}
+}
+
+func requiredParam(param string) *paramError {
+	return &paramError{param: param, messageId: "RequiredQueryParam", message: "{{.Param}} is required."}
+}
+
+// errorModel turns e into a 400 or 422 error whose field is the offending
+// parameter, localized with lang when there is one.
+func (e *paramError) errorModel(lang Language) errors.ErrorModel {
+	base := errors.DefaultUnProcessable
+	if e.malformed {
+		base = DefaultInvalidQueryError
+	}
+	return base.WithErrors(map[string]any{e.param: e.localize(lang)})
+}
+
+func (e *paramError) localize(lang Language) string {
+	if lang == nil {
+		return strings.ReplaceAll(e.message, "{{.Param}}", e.param)
+	}
+	return lang.Localize(e.messageId, e.message, map[string]any{"Param": e.param})
+}
+
+// fieldErrors reports every one of errs in a single 422 error, keeping the
+// first error of each field.
+func fieldErrors(errs []*paramError, lang Language) errors.ErrorModel {
+	fields := make(map[string]any, len(errs))
+	for _, e := range errs {
+		if _, ok := fields[e.param]; !ok {
+			fields[e.param] = e.localize(lang)
+		}
 	}
+	return errors.DefaultUnProcessable.WithErrors(fields)
 }
@@ -0,0 +1,175 @@
+package gateway
+
+import (
+	errors "github.com/haderianous/go-error"
+	"github.com/haderianous/go-logger/logger"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestParseFilterParams(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		filters   []Filter
+		sorts     []Sort
+		param     string
+		malformed bool
+	}{
+		{
+			name:    "empty",
+			query:   "page=2",
+			filters: []Filter{},
+			sorts:   []Sort{},
+		},
+		{
+			name:    "filters and sorts",
+			query:   "filters[0][k]=name&filters[0][op]=ct&filters[0][v]=ali&sorts[0][k]=id&sorts[0][v]=DESC",
+			filters: []Filter{{Key: "name", Op: Ct, Value: []interface{}{"ali"}}},
+			sorts:   []Sort{{Key: "id", Value: "desc"}},
+		},
+		{
+			name:    "indexes above nine are ordered numerically",
+			query:   "filters[10][k]=b&filters[2][k]=a&filters[10][v]=2&filters[2][v]=1",
+			filters: []Filter{{Key: "a", Op: Eq, Value: []interface{}{"1"}}, {Key: "b", Op: Eq, Value: []interface{}{"2"}}},
+			sorts:   []Sort{},
+		},
+		{
+			name:    "escaped values",
+			query:   "filters[0][k]=q&filters[0][op]=in&filters[0][v]=" + url.QueryEscape("a=b&c") + "&filters[0][v]=" + url.QueryEscape("x y"),
+			filters: []Filter{{Key: "q", Op: In, Value: []interface{}{"a=b&c", "x y"}}},
+			sorts:   []Sort{},
+		},
+		{
+			name:    "escaped brackets",
+			query:   url.QueryEscape("sorts[3][k]") + "=name",
+			filters: []Filter{},
+			sorts:   []Sort{{Key: "name", Value: "asc"}},
+		},
+		{
+			name:    "operations",
+			query:   "filters[0][k]=id&filters[0][op]=in&filters[0][v]=1&filters[0][v]=2&filters[1][k]=deleted_at&filters[1][op]=null",
+			filters: []Filter{{Key: "id", Op: In, Value: []interface{}{"1", "2"}}, {Key: "deleted_at", Op: IsNull}},
+			sorts:   []Sort{},
+		},
+		{
+			name:    "groups",
+			query:   "filters[0][k]=a&filters[0][v]=1&filters[0][g]=x&filters[1][k]=b&filters[1][op]=gte&filters[1][v]=2&filters[1][g]=x",
+			filters: []Filter{{Key: "a", Op: Eq, Value: []interface{}{"1"}, Group: "x"}, {Key: "b", Op: Gte, Value: []interface{}{"2"}, Group: "x"}},
+			sorts:   []Sort{},
+		},
+		{name: "unknown operation", query: "filters[0][k]=a&filters[0][op]=like&filters[0][v]=1", param: "filters[0][op]"},
+		{name: "between needs two values", query: "filters[0][k]=a&filters[0][op]=bt&filters[0][v]=1", param: "filters[0][v]"},
+		{name: "null takes no value", query: "filters[0][k]=a&filters[0][op]=null&filters[0][v]=1", param: "filters[0][v]"},
+		{name: "malformed key", query: "filters[0]=x", param: "filters[0]", malformed: true},
+		{name: "negative index", query: "filters[-1][k]=x", param: "filters[-1][k]", malformed: true},
+		{name: "overflowing index", query: "sorts[99999999999999999999][k]=x", param: "sorts[99999999999999999999][k]", malformed: true},
+		{name: "unknown field", query: "filters[0][x]=x", param: "filters[0][x]", malformed: true},
+		{name: "bad escape", query: "filters[0][k]=%zz", param: "query", malformed: true},
+		{name: "missing key", query: "filters[4][v]=x", param: "filters[4][k]"},
+		{name: "repeated key", query: "filters[0][k]=a&filters[0][k]=b", param: "filters[0][k]"},
+		{name: "bad direction", query: "sorts[0][k]=id&sorts[0][v]=up", param: "sorts[0][v]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters, sorts, err := parseFilterParams(tt.query)
+			if tt.param != "" {
+				if assert.NotNil(t, err) {
+					assert.Equal(t, tt.param, err.param)
+					assert.Equal(t, tt.malformed, err.malformed)
+				}
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.filters, filters)
+			assert.Equal(t, tt.sorts, sorts)
+		})
+	}
+}
+
+type filtersHandler struct {
+	params FilterParams
+}
+
+func (h *filtersHandler) Handle(req Request) (any, errors.ErrorModel) {
+	if err := req.BindFilters(); err != nil {
+		return nil, err
+	}
+	h.params = req.Filters()
+	return nil, nil
+}
+
+func TestFilterParams_Groups(t *testing.T) {
+	a := Filter{Key: "a", Op: Eq, Group: "x"}
+	b := Filter{Key: "b", Op: Gt}
+	c := Filter{Key: "c", Op: Lt, Group: "x"}
+	params := FilterParams{Filters: []Filter{a, b, c}}
+	assert.Equal(t, [][]Filter{{a, c}, {b}}, params.Groups())
+}
+
+func TestRequest_BindFilters(t *testing.T) {
+	respond := NewResponder(i18n.NewBundle(language.English))
+	c := NewController(respond, logger.NewLogger(logger.WarnLevel, logger.JsonEncoding))
+	s := NewServer(c)
+	rg := s.NewRouterGroup("api")
+	h := &filtersHandler{}
+	rg.Get("users", h)
+
+	serve := func(query string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, "/api/users?"+query, nil)
+		req.Header.Set("Accept-Language", "en")
+		w := httptest.NewRecorder()
+		rg.ServeHttp(w, req)
+		return w
+	}
+
+	w := serve("page=3&filters[11][k]=name&filters[11][v]=ali")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 3, h.params.Page)
+	assert.Equal(t, []Filter{{Key: "name", Op: Eq, Value: []interface{}{"ali"}}}, h.params.Filters)
+
+	w = serve("filters[0]=x")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"filters[0]"`)
+	assert.Contains(t, w.Body.String(), "filters[0] is malformed.")
+
+	w = serve("sorts[0][k]=id&sorts[0][v]=up")
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "sorts[0][v] must be asc or desc.")
+}
+
+func FuzzParseFilterParams(f *testing.F) {
+	for _, seed := range []string{
+		"",
+		"filters[0][k]=name&filters[0][op]=eq&filters[0][v]=ali",
+		"filters[12][k]=a&filters[12][op]=in&filters[12][v]=1&filters[12][v]=2&filters[13][k]=b&filters[13][g]=or&sorts[3][k]=id&sorts[3][v]=desc",
+		"filters[0]=x",
+		"sorts[",
+		"filters[0][k]=%zz",
+		"filters%5B0%5D%5Bk%5D=a%3Db",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, query string) {
+		filters, sorts, err := parseFilterParams(query)
+		if err != nil {
+			assert.NotEmpty(t, err.param)
+			assert.Nil(t, filters)
+			assert.Nil(t, sorts)
+			return
+		}
+		for _, filter := range filters {
+			assert.NotEmpty(t, filter.Key)
+			assert.True(t, filter.Op.Valid())
+		}
+		for _, s := range sorts {
+			assert.NotEmpty(t, s.Key)
+			assert.Contains(t, []any{"asc", "desc"}, s.Value)
+		}
+	})
+}
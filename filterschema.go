@@ -0,0 +1,199 @@
+package gateway
+
+import (
+	stderrors "errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldType is the type BindFilters converts the values of a field to.
+type FieldType string
+
+const (
+	// StringField keeps values as they are, it is the default.
+	StringField FieldType = "string"
+	IntField    FieldType = "int"
+	FloatField  FieldType = "float"
+	BoolField   FieldType = "bool"
+	// TimeField accepts RFC 3339 times and 2006-01-02 dates.
+	TimeField FieldType = "time"
+	// UUIDField accepts canonical UUIDs and lowercases them.
+	UUIDField FieldType = "uuid"
+)
+
+// FilterField exposes a column to filters and sorts under a public key.
+type FilterField struct {
+	Column string
+	Type   FieldType
+	// Operations allowed on the field, when empty every one of Operations,
+	// except ct, sw and ew on fields that are not strings.
+	Operations []Operation
+	Sortable   bool
+	// Nullable fields cannot order keyset pages, requests sorting them are
+	// refused when the schema has Cursors.
+	Nullable bool
+}
+
+// FilterSchema declares the filters and sorts of an endpoint, any key
+// missing from Fields is rejected.
+type FilterSchema struct {
+	Fields map[string]FilterField
+	// DefaultSort is used when a request gives no sorts.
+	DefaultSort []Sort
+	// UniqueKey names a field of Fields unique to every row, it ends every
+	// order so pages are stable.
+	UniqueKey string
+	// Cursors enables keyset pagination, see FilterParams.Find. It needs a
+	// UniqueKey.
+	Cursors *CursorSigner
+}
+
+// validate reports the schemas keyset pagination cannot work with.
+func (s FilterSchema) validate() error {
+	if s.Cursors == nil {
+		return nil
+	}
+	if s.UniqueKey == "" {
+		return stderrors.New("gateway: a FilterSchema with Cursors needs a UniqueKey")
+	}
+	if s.Fields[s.UniqueKey].Nullable {
+		return fmt.Errorf("gateway: the UniqueKey %s of a FilterSchema cannot be Nullable", s.UniqueKey)
+	}
+	for _, order := range s.DefaultSort {
+		if s.Fields[order.Key].Nullable {
+			return fmt.Errorf("gateway: the DefaultSort of a FilterSchema with Cursors cannot order by the Nullable %s", order.Key)
+		}
+	}
+	return nil
+}
+
+// FilterSchemaKey is the metadata key holding the FilterSchema of a route,
+// set it on a route with Filterable.
+const FilterSchemaKey = "filter_schema"
+
+// Filterable sets the FilterSchema BindFilters validates the route's
+// filters and sorts with.
+func Filterable(schema FilterSchema) Handler {
+	return Meta(FilterSchemaKey, schema)
+}
+
+func (f FilterField) allows(op Operation) bool {
+	if len(f.Operations) == 0 {
+		return f.isString() || (op != Ct && op != StartsWith && op != EndsWith)
+	}
+	for _, allowed := range f.Operations {
+		if allowed == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (f FilterField) isString() bool {
+	return f.Type == "" || f.Type == StringField
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// convert parses value as t, reporting false when it is not one.
+func (t FieldType) convert(value string) (any, bool) {
+	switch t {
+	case IntField:
+		v, err := strconv.ParseInt(value, 10, 64)
+		return v, err == nil
+	case FloatField:
+		v, err := strconv.ParseFloat(value, 64)
+		return v, err == nil
+	case BoolField:
+		v, err := strconv.ParseBool(value)
+		return v, err == nil
+	case TimeField:
+		if v, err := time.Parse(time.RFC3339, value); err == nil {
+			return v, true
+		}
+		v, err := time.Parse("2006-01-02", value)
+		return v, err == nil
+	case UUIDField:
+		return strings.ToLower(value), uuidPattern.MatchString(value)
+	}
+	return value, true
+}
+
+var invalidValueMessages = map[FieldType][2]string{
+	IntField:   {"InvalidIntFilterValue", "{{.Param}} must be an integer."},
+	FloatField: {"InvalidFloatFilterValue", "{{.Param}} must be a number."},
+	BoolField:  {"InvalidBoolFilterValue", "{{.Param}} must be true or false."},
+	TimeField:  {"InvalidTimeFilterValue", "{{.Param}} must be a date or an RFC 3339 time."},
+	UUIDField:  {"InvalidUUIDFilterValue", "{{.Param}} must be a UUID."},
+}
+
+// bind checks filters and sorts against s and converts filter values to the
+// types of their fields, errors are keyed by the public key of the field.
+// Sorts fall back to DefaultSort when there are none.
+func (s FilterSchema) bind(filters []Filter, sorts []Sort) ([]Filter, []Sort, []*paramError) {
+	var errs []*paramError
+	bound := make([]Filter, 0, len(filters))
+	for _, f := range filters {
+		field, ok := s.Fields[f.Key]
+		if !ok {
+			errs = append(errs, unknownFilterKey(f.Key))
+			continue
+		}
+		if !field.allows(f.Op) {
+			errs = append(errs, operationNotAllowed(f.Key))
+			continue
+		}
+		values := make([]interface{}, 0, len(f.Value))
+		valid := true
+		for _, v := range f.Value {
+			raw, ok := v.(string)
+			if !ok {
+				values = append(values, v)
+				continue
+			}
+			converted, ok := field.Type.convert(raw)
+			if !ok {
+				valid = false
+				break
+			}
+			values = append(values, converted)
+		}
+		if !valid {
+			message := invalidValueMessages[field.Type]
+			errs = append(errs, &paramError{param: f.Key, messageId: message[0], message: message[1]})
+			continue
+		}
+		f.Value = values
+		bound = append(bound, f)
+	}
+
+	for _, order := range sorts {
+		if field, ok := s.Fields[order.Key]; !ok || !field.Sortable {
+			errs = append(errs, unknownSortKey(order.Key))
+		} else if field.Nullable && s.Cursors != nil {
+			errs = append(errs, &paramError{param: order.Key, messageId: "NullableCursorSort", message: "{{.Param}} cannot be sorted since it may be empty."})
+		}
+	}
+	if len(sorts) == 0 && len(s.DefaultSort) > 0 {
+		sorts = append([]Sort(nil), s.DefaultSort...)
+	}
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+	return bound, sorts, nil
+}
+
+func unknownFilterKey(key string) *paramError {
+	return &paramError{param: key, messageId: "UnknownFilterKey", message: "{{.Param}} cannot be filtered."}
+}
+
+func operationNotAllowed(key string) *paramError {
+	return &paramError{param: key, messageId: "FilterOperationNotAllowed", message: "{{.Param}} does not support the given operation."}
+}
+
+func unknownSortKey(key string) *paramError {
+	return &paramError{param: key, messageId: "UnknownSortKey", message: "{{.Param}} cannot be sorted."}
+}
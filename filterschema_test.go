@@ -0,0 +1,100 @@
+package gateway
+
+import (
+	"github.com/haderianous/go-logger/logger"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var orders = FilterSchema{
+	Fields: map[string]FilterField{
+		"id":       {Column: "id", Type: UUIDField},
+		"customer": {Column: "customer_name", Sortable: true},
+		"total":    {Column: "total", Type: FloatField, Sortable: true},
+		"items":    {Column: "items", Type: IntField, Operations: []Operation{Eq, Gt, Lt}},
+		"paid":     {Column: "paid", Type: BoolField},
+		"created":  {Column: "created_at", Type: TimeField, Sortable: true},
+	},
+	DefaultSort: []Sort{{Key: "created", Value: "desc"}},
+}
+
+func TestFilterSchema_bind(t *testing.T) {
+	filters, sorts, errs := orders.bind([]Filter{
+		{Key: "id", Op: In, Value: []interface{}{"0F8FAD5B-D9CB-469F-A165-70867728950E"}},
+		{Key: "customer", Op: Ct, Value: []interface{}{"ali"}},
+		{Key: "total", Op: Gte, Value: []interface{}{"9.5"}},
+		{Key: "items", Op: Gt, Value: []interface{}{"2"}},
+		{Key: "paid", Op: Eq, Value: []interface{}{"true"}},
+		{Key: "created", Op: Bt, Value: []interface{}{"2024-01-01", "2024-01-31T23:59:59Z"}},
+	}, nil)
+	assert.Nil(t, errs)
+	assert.Equal(t, []Filter{
+		{Key: "id", Op: In, Value: []interface{}{"0f8fad5b-d9cb-469f-a165-70867728950e"}},
+		{Key: "customer", Op: Ct, Value: []interface{}{"ali"}},
+		{Key: "total", Op: Gte, Value: []interface{}{9.5}},
+		{Key: "items", Op: Gt, Value: []interface{}{int64(2)}},
+		{Key: "paid", Op: Eq, Value: []interface{}{true}},
+		{Key: "created", Op: Bt, Value: []interface{}{time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 1, 31, 23, 59, 59, 0, time.UTC)}},
+	}, filters)
+	assert.Equal(t, orders.DefaultSort, sorts)
+
+	_, _, errs = orders.bind([]Filter{
+		{Key: "id", Op: Eq, Value: []interface{}{"42"}},
+		{Key: "total", Op: Ct, Value: []interface{}{"9"}},
+		{Key: "items", Op: Gte, Value: []interface{}{"2"}},
+		{Key: "paid", Op: Eq, Value: []interface{}{"maybe"}},
+		{Key: "secret", Op: Eq, Value: []interface{}{"x"}},
+	}, []Sort{{Key: "paid", Value: "asc"}})
+	messages := map[string]string{}
+	for _, e := range errs {
+		if _, ok := messages[e.param]; !ok {
+			messages[e.param] = e.messageId
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"id":     "InvalidUUIDFilterValue",
+		"total":  "FilterOperationNotAllowed",
+		"items":  "FilterOperationNotAllowed",
+		"paid":   "InvalidBoolFilterValue",
+		"secret": "UnknownFilterKey",
+	}, messages)
+	assert.Len(t, errs, 6)
+}
+
+func TestRequest_BindFiltersWithSchema(t *testing.T) {
+	bundle := i18n.NewBundle(language.English)
+	respond := NewResponder(bundle)
+	c := NewController(respond, logger.NewLogger(logger.WarnLevel, logger.JsonEncoding))
+	s := NewServer(c)
+	rg := s.NewRouterGroup("api")
+	h := &filtersHandler{}
+	rg.Get("orders", Filterable(orders), h)
+
+	serve := func(query string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, "/api/orders?"+query, nil)
+		req.Header.Set("Accept-Language", "en")
+		w := httptest.NewRecorder()
+		rg.ServeHttp(w, req)
+		return w
+	}
+
+	w := serve("filters[0][k]=items&filters[0][op]=gt&filters[0][v]=3&sorts[0][k]=total&sorts[0][v]=desc")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []Filter{{Key: "items", Op: Gt, Value: []interface{}{int64(3)}}}, h.params.Filters)
+	assert.Equal(t, []Sort{{Key: "total", Value: "desc"}}, h.params.Sorts)
+
+	w = serve("filters[0][k]=items&filters[0][v]=three&filters[1][k]=created&filters[1][v]=yesterday&sorts[0][k]=id")
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "items must be an integer.")
+	assert.Contains(t, w.Body.String(), "created must be a date or an RFC 3339 time.")
+	assert.Contains(t, w.Body.String(), "id cannot be sorted.")
+
+	assert.PanicsWithValue(t, "gateway: the filter_schema metadata of route GET invoices is a *gateway.FilterSchema, set it with Filterable", func() {
+		rg.Get("invoices", Meta(FilterSchemaKey, &orders), h)
+	})
+}
@@ -0,0 +1,139 @@
+package gateway
+
+import (
+	"github.com/gin-gonic/gin"
+	errors "github.com/haderianous/go-error"
+	"net/http"
+	"strings"
+)
+
+type ginHandler struct {
+	fn gin.HandlerFunc
+}
+
+// GinHandler lets a gin middleware or handler take part in a route chain.
+// Aborting the gin context or writing a response ends the chain.
+func GinHandler(fn gin.HandlerFunc) Handler {
+	return &ginHandler{fn: fn}
+}
+
+func (h *ginHandler) Handle(req Request) (any, errors.ErrorModel) {
+	c := req.GinContext()
+	h.fn(c)
+	if c.IsAborted() || c.Writer.Written() {
+		req.SetIsResponded(true)
+	}
+	return nil, nil
+}
+
+type httpMiddleware struct {
+	mw func(http.Handler) http.Handler
+}
+
+// HTTPMiddleware lets a net/http middleware take part in a route chain. The
+// rest of the chain runs when the middleware calls the next handler, a
+// middleware answering on its own ends the chain.
+func HTTPMiddleware(mw func(http.Handler) http.Handler) Handler {
+	return &httpMiddleware{mw: mw}
+}
+
+func (h *httpMiddleware) Handle(req Request) (any, errors.ErrorModel) {
+	c := req.GinContext()
+	original := c.Writer
+	called := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		c.Request = r
+		if w != http.ResponseWriter(original) {
+			c.Writer = &wrappedWriter{ResponseWriter: original, w: w, status: http.StatusOK, size: -1}
+		}
+		c.Next()
+		c.Writer = original
+	})
+	h.mw(next).ServeHTTP(original, c.Request)
+	if !called {
+		req.SetIsResponded(true)
+		c.Abort()
+	}
+	return nil, nil
+}
+
+type httpHandler struct {
+	handler http.Handler
+	prefix  string
+}
+
+// HTTPHandler serves a route with a plain http.Handler. The prefix is
+// stripped from the request path before the handler sees it.
+func HTTPHandler(handler http.Handler, prefix string) Handler {
+	return &httpHandler{handler: handler, prefix: prefix}
+}
+
+func (h *httpHandler) Handle(req Request) (any, errors.ErrorModel) {
+	r := req.Request()
+	if h.prefix != "" {
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = "/" + strings.TrimLeft(strings.TrimPrefix(r.URL.Path, h.prefix), "/")
+		r2.URL.RawPath = ""
+		r = r2
+	}
+	h.handler.ServeHTTP(req.Writer(), r)
+	req.SetIsResponded(true)
+	return nil, nil
+}
+
+// wrappedWriter routes gin writes through the writer a net/http middleware
+// handed to its next handler, e.g. a gzip writer.
+type wrappedWriter struct {
+	gin.ResponseWriter
+	w      http.ResponseWriter
+	status int
+	size   int
+}
+
+func (w *wrappedWriter) Header() http.Header {
+	return w.w.Header()
+}
+
+func (w *wrappedWriter) WriteHeader(code int) {
+	if code > 0 && !w.Written() {
+		w.status = code
+	}
+}
+
+func (w *wrappedWriter) WriteHeaderNow() {
+	if !w.Written() {
+		w.size = 0
+		w.w.WriteHeader(w.status)
+	}
+}
+
+func (w *wrappedWriter) Write(b []byte) (int, error) {
+	w.WriteHeaderNow()
+	n, err := w.w.Write(b)
+	w.size += n
+	return n, err
+}
+
+func (w *wrappedWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *wrappedWriter) Status() int {
+	return w.status
+}
+
+func (w *wrappedWriter) Size() int {
+	return w.size
+}
+
+func (w *wrappedWriter) Written() bool {
+	return w.size != -1
+}
+
+func (w *wrappedWriter) Flush() {
+	w.WriteHeaderNow()
+	if f, ok := w.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,66 @@
+package gateway
+
+import (
+	stderrors "errors"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const unixPrefix = "unix:"
+
+func defaultAddress() string {
+	if port := os.Getenv("PORT"); port != "" {
+		return ":" + port
+	}
+	return ":8080"
+}
+
+// listenAll opens a listener for every address, closing the ones already
+// opened when any of them fails.
+func listenAll(addresses []string) ([]net.Listener, error) {
+	if len(addresses) == 0 {
+		addresses = []string{defaultAddress()}
+	}
+	listeners := make([]net.Listener, 0, len(addresses))
+	for _, address := range addresses {
+		l, err := listen(address)
+		if err != nil {
+			for _, opened := range listeners {
+				_ = opened.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+func listen(address string) (net.Listener, error) {
+	if !strings.HasPrefix(address, unixPrefix) {
+		return net.Listen("tcp", address)
+	}
+	path := strings.TrimPrefix(address, unixPrefix)
+	if staleSocket(path) {
+		_ = os.Remove(path)
+	}
+	return net.Listen("unix", path)
+}
+
+// staleSocket reports whether path is a socket left behind by a crashed
+// process, one nobody accepts connections on any more. Sockets of live
+// processes are kept so Listen fails instead of stealing them.
+func staleSocket(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		return false
+	}
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		_ = conn.Close()
+		return false
+	}
+	return stderrors.Is(err, syscall.ECONNREFUSED)
+}
@@ -1,15 +1,33 @@
 package gateway
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gorilla/websocket"
 	errors "github.com/haderianous/go-error"
 	"github.com/haderianous/go-logger/logger"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
 	"github.com/stretchr/testify/assert"
+	"github.com/ugorji/go/codec"
 	"golang.org/x/text/language"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestServer_Run(t *testing.T) {
@@ -93,3 +111,1361 @@ func NewMiddleware() Handler {
 func (h *middleware) Handle(req Request) (any, errors.ErrorModel) {
 	return nil, nil
 }
+
+func TestRouterGroup_Proxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/svc/slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.Header().Set("X-Upstream-Path", r.URL.Path)
+		w.Header().Set("X-Upstream-Raw-Path", r.URL.EscapedPath())
+		w.Header().Set("X-Upstream-Forwarded-Host", r.Header.Get("X-Forwarded-Host"))
+		w.WriteHeader(http.StatusTeapot)
+		_, _ = w.Write([]byte("upstream body"))
+	}))
+	defer upstream.Close()
+	target, _ := url.Parse(upstream.URL + "/svc")
+
+	respond := NewResponder(i18n.NewBundle(language.English))
+	c := NewController(respond, logger.NewLogger(logger.WarnLevel, logger.JsonEncoding))
+	s := NewServer(c)
+	rg := s.NewRouterGroup("api")
+	rg.Proxy("users", target, NewMiddleware())
+	rg.Group("admin").Proxy("users", target, NewErrorHandler())
+	slow, _ := url.Parse(upstream.URL + "/svc/slow")
+	rg.Get("slow", NewProxyHandler(slow, WithStripPrefix("/api/slow"), WithTransport(&http.Transport{ResponseHeaderTimeout: 50 * time.Millisecond})))
+	closed := httptest.NewServer(http.NotFoundHandler())
+	gone, _ := url.Parse(closed.URL)
+	closed.Close()
+	rg.Proxy("gone", gone)
+	gw := httptest.NewServer(http.HandlerFunc(rg.ServeHttp))
+	defer gw.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, gw.URL+"/api/users/12", nil)
+	req.Host = "gateway.local"
+	res, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	body, _ := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusTeapot, res.StatusCode)
+	assert.Equal(t, "/svc/12", res.Header.Get("X-Upstream-Path"))
+	assert.Equal(t, "gateway.local", res.Header.Get("X-Upstream-Forwarded-Host"))
+	assert.Equal(t, "upstream body", string(body))
+
+	req, _ = http.NewRequest(http.MethodGet, gw.URL+"/api/users", nil)
+	res, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, "/svc", res.Header.Get("X-Upstream-Path"))
+
+	req, _ = http.NewRequest(http.MethodGet, gw.URL+"/api/admin/users/12", nil)
+	req.Header.Set("Accept-Language", "en")
+	res, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	assert.Empty(t, res.Header.Get("X-Upstream-Path"))
+
+	req, _ = http.NewRequest(http.MethodGet, gw.URL+"/api/users/a%2Fb", nil)
+	res, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, "/svc/a%2Fb", res.Header.Get("X-Upstream-Raw-Path"))
+
+	res, err = http.Get(gw.URL + "/api/gone")
+	assert.Nil(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusBadGateway, res.StatusCode)
+
+	res, err = http.Get(gw.URL + "/api/slow")
+	assert.Nil(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusGatewayTimeout, res.StatusCode)
+}
+
+func TestRouterGroup_ProxyRoot(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream-Path", r.URL.Path)
+	}))
+	defer upstream.Close()
+	target, _ := url.Parse(upstream.URL + "/svc")
+
+	respond := NewResponder(i18n.NewBundle(language.English))
+	c := NewController(respond, logger.NewLogger(logger.WarnLevel, logger.JsonEncoding))
+	serve := func(s Server, path string) string {
+		gw := httptest.NewServer(http.HandlerFunc(s.NewRouterGroup("").ServeHttp))
+		defer gw.Close()
+		res, err := http.Get(gw.URL + path)
+		assert.Nil(t, err)
+		_ = res.Body.Close()
+		return res.Header.Get("X-Upstream-Path")
+	}
+
+	s := NewServer(c)
+	assert.NotPanics(t, func() { s.NewRouterGroup("api").Proxy("/", target) })
+	assert.NotPanics(t, func() { s.NewRouterGroup("docs").Proxy("guide/", target) })
+	assert.Equal(t, "/svc", serve(s, "/api"))
+	assert.Equal(t, "/svc/users/12", serve(s, "/api/users/12"))
+	assert.Equal(t, "/svc/intro", serve(s, "/docs/guide/intro"))
+
+	root := NewServer(c)
+	assert.NotPanics(t, func() { root.NewRouterGroup("").Proxy("", target) })
+	assert.Equal(t, "/svc", serve(root, "/"))
+	assert.Equal(t, "/svc/health", serve(root, "/health"))
+
+	rg := s.NewRouterGroup("conflict")
+	rg.Get("users/:id", NewHelloHandler())
+	defer func() {
+		assert.Contains(t, recover(), "gateway: /conflict/users/*proxyPath takes every path under it")
+	}()
+	rg.Proxy("users", target)
+}
+
+type slowHandler struct {
+	started chan struct{}
+}
+
+func (h *slowHandler) Handle(req Request) (any, errors.ErrorModel) {
+	close(h.started)
+	time.Sleep(100 * time.Millisecond)
+	return "done", nil
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := l.Addr().String()
+	_ = l.Close()
+
+	respond := NewResponder(i18n.NewBundle(language.English))
+	c := NewController(respond, logger.NewLogger(logger.WarnLevel, logger.JsonEncoding))
+	s := NewServer(c)
+	slow := &slowHandler{started: make(chan struct{})}
+	s.NewRouterGroup("test").Get("slow", slow)
+
+	var order []int
+	s.OnShutdown(func(ctx context.Context) error {
+		order = append(order, 1)
+		return nil
+	})
+	s.OnShutdown(func(ctx context.Context) error {
+		order = append(order, 2)
+		return fmt.Errorf("pool close failed")
+	})
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- s.Run(addr) }()
+
+	var res *http.Response
+	assert.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			_ = conn.Close()
+		}
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	resDone := make(chan struct{})
+	go func() {
+		res, _ = http.Get("http://" + addr + "/test/slow")
+		close(resDone)
+	}()
+
+	<-slow.started
+	err := s.Shutdown(time.Second)
+	<-resDone
+	assert.Nil(t, <-runErr)
+	assert.NotNil(t, res)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.EqualError(t, err, "pool close failed")
+	assert.Equal(t, []int{2, 1}, order)
+}
+
+func TestServer_ShutdownBeforeServe(t *testing.T) {
+	respond := NewResponder(i18n.NewBundle(language.English))
+	c := NewController(respond, logger.NewLogger(logger.WarnLevel, logger.JsonEncoding))
+	s := NewServer(c)
+	assert.NoError(t, s.Shutdown(time.Second))
+
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(l) }()
+	select {
+	case err := <-served:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Serve kept running after Shutdown")
+	}
+	_, err := net.Dial("tcp", l.Addr().String())
+	assert.Error(t, err)
+}
+
+type echoRequest struct {
+	Name string `json:"name"`
+}
+
+func (e *echoRequest) Validate(localize Language) (any, error, map[string]any) {
+	return e, nil, nil
+}
+
+type echoHandler struct{}
+
+func (h *echoHandler) Handle(req Request) (any, errors.ErrorModel) {
+	var body echoRequest
+	if err := req.BindRequest(&body); err != nil {
+		return nil, err
+	}
+	return req.GetBody(), nil
+}
+
+func TestServer_MaxBodySize(t *testing.T) {
+	respond := NewResponder(i18n.NewBundle(language.English))
+	c := NewController(respond, logger.NewLogger(logger.WarnLevel, logger.JsonEncoding))
+	s := NewServer(c, ServerOptions{MaxBodySize: 16})
+	rg := s.NewRouterGroup("test")
+	var read []string
+	rg.Middleware(GinHandler(func(c *gin.Context) {
+		// reads the body before any route handler does
+		b, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			read = append(read, err.Error())
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(b))
+	}))
+	rg.Post("small", &echoHandler{})
+	rg.Post("large", NewBodyLimitHandler(1024), &echoHandler{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+	}))
+	defer upstream.Close()
+	target, _ := url.Parse(upstream.URL)
+	s.NewRouterGroup("proxy").Proxy("svc", target)
+
+	body := `{"name":"a rather long name"}`
+	send := func(path string, chunked bool) int {
+		req, _ := http.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if chunked {
+			req.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		rg.ServeHttp(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusRequestEntityTooLarge, send("/test/small", false))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, send("/test/small", true))
+	assert.Equal(t, http.StatusOK, send("/test/large", false))
+	assert.Equal(t, http.StatusOK, send("/test/large", true))
+	assert.Equal(t, []string{"http: request body too large"}, read)
+
+	gw := httptest.NewServer(http.HandlerFunc(rg.ServeHttp))
+	defer gw.Close()
+	req, _ := http.NewRequest(http.MethodPost, gw.URL+"/proxy/svc", io.MultiReader(strings.NewReader(body)))
+	res, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+}
+
+func TestServer_RunMultipleAddresses(t *testing.T) {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := l.Addr().String()
+	_ = l.Close()
+	sock := filepath.Join(t.TempDir(), "gateway.sock")
+
+	respond := NewResponder(i18n.NewBundle(language.English))
+	c := NewController(respond, logger.NewLogger(logger.WarnLevel, logger.JsonEncoding))
+	s := NewServer(c)
+	s.NewRouterGroup("test").Get("success", NewHelloHandler())
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- s.Run(addr, "unix:"+sock) }()
+
+	unixClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		},
+	}}
+	for _, client := range []*http.Client{http.DefaultClient, unixClient} {
+		client := client
+		assert.Eventually(t, func() bool {
+			res, err := client.Get("http://" + addr + "/test/success")
+			if err != nil {
+				return false
+			}
+			_ = res.Body.Close()
+			return res.StatusCode == http.StatusOK
+		}, time.Second, 10*time.Millisecond)
+	}
+
+	assert.Nil(t, s.Shutdown(time.Second))
+	assert.Nil(t, <-runErr)
+	_, err := net.Dial("tcp", addr)
+	assert.NotNil(t, err)
+	_, err = os.Stat(sock)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestListen_UnixSocket(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "gateway.sock")
+	live, err := net.Listen("unix", sock)
+	assert.NoError(t, err)
+	_, err = listen("unix:" + sock)
+	assert.Error(t, err, "the socket of a live process is kept")
+
+	live.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = live.Close()
+	_, err = os.Stat(sock)
+	assert.NoError(t, err)
+	l, err := listen("unix:" + sock)
+	if assert.NoError(t, err, "a stale socket is replaced") {
+		_ = l.Close()
+	}
+
+	file := filepath.Join(t.TempDir(), "not-a-socket")
+	assert.NoError(t, os.WriteFile(file, nil, 0o600))
+	_, err = listen("unix:" + file)
+	assert.Error(t, err)
+	_, err = os.Stat(file)
+	assert.NoError(t, err)
+
+	assert.Error(t, NewServer(nil).Serve())
+}
+
+type sleepHandler struct {
+	delay  time.Duration
+	ctxErr chan error
+}
+
+func (h *sleepHandler) Handle(req Request) (any, errors.ErrorModel) {
+	select {
+	case <-time.After(h.delay):
+	case <-req.GetContext().Done():
+	}
+	time.Sleep(10 * time.Millisecond)
+	req.Writer().Header().Set("X-Late", "true")
+	if h.ctxErr != nil {
+		h.ctxErr <- req.GetContext().Err()
+	}
+	return "late", nil
+}
+
+func TestRouterGroup_WithTimeout(t *testing.T) {
+	respond := NewResponder(i18n.NewBundle(language.English))
+	c := NewController(respond, logger.NewLogger(logger.WarnLevel, logger.JsonEncoding))
+	s := NewServer(c)
+	rg := s.NewRouterGroup("test").WithTimeout(20 * time.Millisecond)
+	slow := &sleepHandler{delay: time.Second, ctxErr: make(chan error, 1)}
+	rg.Get("slow", NewMiddleware(), slow)
+	rg.Get("fast", NewMiddleware(), &sleepHandler{})
+
+	req, _ := http.NewRequest(http.MethodGet, "/test/slow", nil)
+	req.Header.Set("Accept-Language", "en")
+	w := httptest.NewRecorder()
+	rg.ServeHttp(w, req)
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Equal(t, context.DeadlineExceeded, <-slow.ctxErr)
+	assert.Empty(t, w.Header().Get("X-Late"))
+	assert.NotContains(t, w.Body.String(), "late")
+
+	req, _ = http.NewRequest(http.MethodGet, "/test/fast", nil)
+	w = httptest.NewRecorder()
+	rg.ServeHttp(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "true", w.Header().Get("X-Late"))
+	assert.Contains(t, w.Body.String(), "late")
+}
+
+type pollingHandler struct{}
+
+// Handle keeps reading the writer after the deadline, as late handlers
+// checking whether they may still answer do.
+func (h *pollingHandler) Handle(req Request) (any, errors.ErrorModel) {
+	until := time.After(30 * time.Millisecond)
+	for {
+		select {
+		case <-until:
+			return "late", nil
+		default:
+			_ = req.Status()
+			_ = req.Size()
+			_ = req.GinContext().Writer.Written()
+		}
+	}
+}
+
+type holdEventsHandler struct {
+	release chan struct{}
+}
+
+func (h *holdEventsHandler) Handle(req Request) (any, errors.ErrorModel) {
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		events <- Event{ID: "1", Data: "first"}
+		<-h.release
+		events <- Event{ID: "2", Data: "second"}
+	}()
+	_ = req.SendEvents(events, 0)
+	return nil, nil
+}
+
+func TestRouterGroup_WithTimeoutChain(t *testing.T) {
+	respond := NewResponder(i18n.NewBundle(language.English))
+	c := NewController(respond, logger.NewLogger(logger.WarnLevel, logger.JsonEncoding))
+	s := NewServer(c)
+	rg := s.NewRouterGroup("test").WithTimeout(time.Second)
+	rg.Get("hello", HTTPMiddleware(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Middleware", "true")
+			next.ServeHTTP(w, r)
+		})
+	}), GinHandler(func(c *gin.Context) {
+		c.Next()
+	}), NewHelloHandler())
+	hold := &holdEventsHandler{release: make(chan struct{})}
+	rg.Get("events", hold)
+	s.NewRouterGroup("polling").WithTimeout(5*time.Millisecond).Get("", &pollingHandler{})
+	ts := httptest.NewServer(http.HandlerFunc(rg.ServeHttp))
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, "/polling", nil)
+	w := httptest.NewRecorder()
+	rg.ServeHttp(w, req)
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.NotContains(t, w.Body.String(), "late")
+
+	res, err := http.Get(ts.URL + "/test/hello")
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "true", res.Header.Get("X-Middleware"))
+	assert.Contains(t, string(body), "saeed")
+
+	res, err = http.Get(ts.URL + "/test/events")
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	reader := bufio.NewReader(res.Body)
+	line, err := reader.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "id: 1\n", line)
+	close(hold.release)
+	rest, _ := io.ReadAll(reader)
+	assert.Contains(t, string(rest), "id: 2\ndata: second\n\n")
+}
+
+func TestRouterGroup_Methods(t *testing.T) {
+	respond := NewResponder(i18n.NewBundle(language.English))
+	c := NewController(respond, logger.NewLogger(logger.WarnLevel, logger.JsonEncoding))
+	s := NewServer(c)
+	rg := s.NewRouterGroup("test")
+	rg.Get("users/:id", NewHelloHandler())
+	rg.Patch("users/:id", NewHelloHandler())
+	rg.Head("users/:id", NewHelloHandler())
+	rg.Handle("PURGE", "cache", NewHelloHandler())
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, nil)
+		req.Header.Set("Accept-Language", "en")
+		w := httptest.NewRecorder()
+		rg.ServeHttp(w, req)
+		return w
+	}
+
+	w := serve(http.MethodPatch, "/test/users/1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "saeed")
+
+	w = serve(http.MethodHead, "/test/users/1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 0, w.Body.Len())
+
+	w = serve("PURGE", "/test/cache")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = serve(http.MethodDelete, "/test/users/1")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET, PATCH, HEAD", w.Header().Get("Allow"))
+	assert.Contains(t, w.Body.String(), "The request method is not allowed for this route.")
+}
+
+func TestServer_Routes(t *testing.T) {
+	respond := NewResponder(i18n.NewBundle(language.English))
+	c := NewController(respond, logger.NewLogger(logger.WarnLevel, logger.JsonEncoding))
+	s := NewServer(c)
+	rg := s.NewRouterGroup("api")
+	rg.Middleware(NewMiddleware())
+	admin := rg.Group("admin")
+	admin.Middleware(NewErrorHandler())
+	admin.Get("users/:id", NewHelloHandler())
+	rg.Post("users", NewHelloHandler())
+	rg.Get("routes", NewRouteTableHandler(s))
+
+	assert.Equal(t, []RouteInfo{
+		{Method: http.MethodGet, Path: "/api/admin/users/:id", Handler: "*gateway.handler", Middlewares: []string{"*gateway.middleware", "*gateway.errHandler"}},
+		{Method: http.MethodPost, Path: "/api/users", Handler: "*gateway.handler", Middlewares: []string{"*gateway.middleware"}},
+		{Method: http.MethodGet, Path: "/api/routes", Handler: "*gateway.routeTableHandler", Middlewares: []string{"*gateway.middleware"}},
+	}, s.Routes())
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/routes", nil)
+	w := httptest.NewRecorder()
+	rg.ServeHttp(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var res Response
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&res))
+	assert.Equal(t, 3, res.Data.Total)
+	assert.Len(t, res.Data.Result, 3)
+}
+
+type getUserRequest struct {
+	ID     int    `uri:"id" binding:"required"`
+	Fields string `form:"fields"`
+	Name   string `json:"name" binding:"required"`
+}
+
+func (r *getUserRequest) Validate(localize Language) (any, error, map[string]any) {
+	return r, nil, nil
+}
+
+func TestServer_OpenAPI(t *testing.T) {
+	respond := NewResponder(i18n.NewBundle(language.English), WithEncoder(XMLEncoder()), WithEncoder(YAMLEncoder()), WithEncoder(MsgPackEncoder()), WithEncoder(ProtobufEncoder()))
+	c := NewController(respond, logger.NewLogger(logger.WarnLevel, logger.JsonEncoding))
+	s := NewServer(c)
+	rg := s.NewRouterGroup("api")
+	type user struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}
+	rg.Put("users/:id", Document(NewHelloHandler(), RouteDoc{
+		Summary:  "Update a user",
+		Request:  &getUserRequest{},
+		Response: []user{},
+	}))
+	rg.Get("users", Document(NewHelloHandler(), RouteDoc{Filterable: true}))
+	rg.Delete("users/:id", Document(NewHelloHandler(), RouteDoc{Status: http.StatusNoContent, Errors: []errors.ErrorModel{errors.DefaultNotFound}}))
+	rg.WithEnvelope(ProblemEnvelope()).WithTimeout(time.Second).Get("reports", Meta(ShapeKey, ShapeObject), Document(NewHelloHandler(), RouteDoc{Response: user{}}))
+	upstream, _ := url.Parse("http://127.0.0.1:1")
+	rg.Proxy("legacy", upstream)
+	rg.WithEnvelope(JSONAPIEnvelope()).Get("articles", Document(NewHelloHandler(), RouteDoc{Response: []user{}}))
+	rg.Get("openapi.json", NewOpenAPIHandler(s, OpenAPIInfo{Title: "users", Version: "1.0.0"}))
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/openapi.json", nil)
+	w := httptest.NewRecorder()
+	rg.ServeHttp(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+		Paths   map[string]map[string]struct {
+			Summary    string `json:"summary"`
+			Parameters []struct {
+				Name     string `json:"name"`
+				In       string `json:"in"`
+				Required bool   `json:"required"`
+			} `json:"parameters"`
+			RequestBody struct {
+				Content map[string]struct {
+					Schema struct {
+						Required []string `json:"required"`
+					} `json:"schema"`
+				} `json:"content"`
+			} `json:"requestBody"`
+			Responses map[string]any `json:"responses"`
+		} `json:"paths"`
+	}
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&doc))
+	assert.Equal(t, "3.0.3", doc.OpenAPI)
+
+	put := doc.Paths["/api/users/{id}"]["put"]
+	assert.Equal(t, "Update a user", put.Summary)
+	assert.Len(t, put.Parameters, 2)
+	assert.Equal(t, "id", put.Parameters[0].Name)
+	assert.True(t, put.Parameters[0].Required)
+	assert.Equal(t, "fields", put.Parameters[1].Name)
+	assert.Equal(t, []string{"name"}, put.RequestBody.Content["application/json"].Schema.Required)
+	statuses := func(responses map[string]any) []string {
+		var codes []string
+		for code := range responses {
+			codes = append(codes, code)
+		}
+		return codes
+	}
+	assert.ElementsMatch(t, []string{"200", "406", "422"}, statuses(put.Responses))
+	ok := put.Responses["200"].(map[string]any)["content"].(map[string]any)
+	assert.Contains(t, ok, "application/json")
+	assert.Contains(t, ok, "application/xml")
+	assert.NotContains(t, ok, "application/x-protobuf")
+
+	remove := doc.Paths["/api/users/{id}"]["delete"]
+	assert.ElementsMatch(t, []string{"204", "404", "406"}, statuses(remove.Responses))
+	assert.NotContains(t, remove.Responses["204"], "content")
+
+	reports := doc.Paths["/api/reports"]["get"]
+	assert.ElementsMatch(t, []string{"200", "406", "504"}, statuses(reports.Responses))
+	timeout := reports.Responses["504"].(map[string]any)["content"].(map[string]any)
+	assert.Contains(t, timeout, "application/problem+json")
+	assert.Contains(t, timeout, "application/xml")
+	result := reports.Responses["200"].(map[string]any)["content"].(map[string]any)["application/json"].(map[string]any)["schema"].(map[string]any)["properties"].(map[string]any)["data"].(map[string]any)["properties"].(map[string]any)["result"].(map[string]any)
+	assert.Contains(t, result["properties"], "age")
+
+	assert.ElementsMatch(t, []string{"200", "406", "502", "504"}, statuses(doc.Paths["/api/legacy"]["get"].Responses))
+
+	articles := doc.Paths["/api/articles"]["get"]
+	assert.Contains(t, articles.Responses["200"].(map[string]any)["content"], "application/vnd.api+json")
+	assert.Contains(t, articles.Responses["406"].(map[string]any)["content"], "application/vnd.api+json")
+
+	list := doc.Paths["/api/users"]["get"]
+	var names []string
+	for _, p := range list.Parameters {
+		names = append(names, p.Name)
+	}
+	assert.ElementsMatch(t, []string{"page", "limit", "filters", "sorts"}, names)
+	assert.ElementsMatch(t, []string{"200", "400", "406", "422"}, statuses(list.Responses))
+	assert.Contains(t, doc.Paths, "/api/openapi.json")
+}
+
+type greeting struct {
+	Text string `json:"text"`
+}
+
+type renameRequest struct {
+	ID   string `uri:"id"`
+	Name string `json:"name"`
+}
+
+func (r renameRequest) Validate(localize Language) (any, error, map[string]any) {
+	return r, nil, nil
+}
+
+func TestTyped(t *testing.T) {
+	respond := NewResponder(i18n.NewBundle(language.English))
+	c := NewController(respond, logger.NewLogger(logger.WarnLevel, logger.JsonEncoding))
+	s := NewServer(c)
+	rg := s.NewRouterGroup("api")
+	rg.Post("greet", Typed(func(ctx context.Context, in *echoRequest, req Request) (greeting, errors.ErrorModel) {
+		if in.Name == "" {
+			return greeting{}, errors.DefaultUnProcessable
+		}
+		return greeting{Text: "hello " + in.Name}, nil
+	}))
+	rg.Put("users/:id", Typed(func(ctx context.Context, in renameRequest, req Request) (greeting, errors.ErrorModel) {
+		return greeting{Text: in.ID + " is " + in.Name}, nil
+	}))
+
+	send := func(body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodPost, "/api/greet", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept-Language", "en")
+		w := httptest.NewRecorder()
+		rg.ServeHttp(w, req)
+		return w
+	}
+	w := send(`{"name":"ali"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"text":"hello ali"`)
+	assert.Equal(t, http.StatusUnprocessableEntity, send(`{}`).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, send(`{"name":`).Code)
+
+	req, _ := http.NewRequest(http.MethodPut, "/api/users/12", strings.NewReader(`{"name":"reza"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	rg.ServeHttp(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"text":"12 is reza"`)
+
+	doc := OpenAPI(s, OpenAPIInfo{})
+	op := doc["paths"].(map[string]any)["/api/greet"].(map[string]any)["post"].(map[string]any)
+	assert.Contains(t, op, "requestBody")
+	ok := op["responses"].(map[string]any)["200"].(map[string]any)
+	schema := ok["content"].(map[string]any)["application/json"].(map[string]any)["schema"].(map[string]any)
+	result := schema["properties"].(map[string]any)["data"].(map[string]any)["properties"].(map[string]any)["result"].(map[string]any)
+	assert.Contains(t, result["items"].(map[string]any)["properties"], "text")
+}
+
+type upperWriter struct {
+	http.ResponseWriter
+}
+
+func (w upperWriter) Write(b []byte) (int, error) {
+	return w.ResponseWriter.Write([]byte(strings.ToUpper(string(b))))
+}
+
+type keyHandler struct{}
+
+func (h *keyHandler) Handle(req Request) (any, errors.ErrorModel) {
+	user, _ := req.GetKey("user")
+	return user, nil
+}
+
+func TestRouterGroup_Interop(t *testing.T) {
+	respond := NewResponder(i18n.NewBundle(language.English))
+	c := NewController(respond, logger.NewLogger(logger.WarnLevel, logger.JsonEncoding))
+	s := NewServer(c)
+	rg := s.NewRouterGroup("api")
+	rg.UseHTTP(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("X-Traced", "true")
+			next.ServeHTTP(upperWriter{w}, r)
+		})
+	})
+	rg.Middleware(GinHandler(func(c *gin.Context) {
+		c.Set("user", "ali")
+	}))
+	rg.Get("me", &keyHandler{})
+	rg.Mount("static", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("path " + r.URL.Path))
+	}))
+
+	serve := func(path string, auth bool) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		if auth {
+			req.Header.Set("Authorization", "token")
+		}
+		w := httptest.NewRecorder()
+		rg.ServeHttp(w, req)
+		return w
+	}
+
+	w := serve("/api/me", false)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, 0, w.Body.Len())
+
+	w = serve("/api/me", true)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "true", w.Header().Get("X-Traced"))
+	assert.Contains(t, w.Body.String(), `"RESULT":["ALI"]`)
+
+	w = serve("/api/static/css/site.css", true)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "PATH /CSS/SITE.CSS", w.Body.String())
+}
+
+func TestRouterGroup_MountRoot(t *testing.T) {
+	respond := NewResponder(i18n.NewBundle(language.English))
+	c := NewController(respond, logger.NewLogger(logger.WarnLevel, logger.JsonEncoding))
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("path " + r.URL.Path))
+	})
+	serve := func(s Server, path string) string {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		s.NewRouterGroup("").ServeHttp(w, req)
+		return w.Body.String()
+	}
+
+	s := NewServer(c)
+	assert.NotPanics(t, func() { s.NewRouterGroup("api").Mount("/", echo) })
+	assert.NotPanics(t, func() { s.NewRouterGroup("files").Mount("static/", echo) })
+	assert.Equal(t, "path /", serve(s, "/api"))
+	assert.Equal(t, "path /users/12", serve(s, "/api/users/12"))
+	assert.Equal(t, "path /", serve(s, "/files/static"))
+	assert.Equal(t, "path /site.css", serve(s, "/files/static/site.css"))
+
+	root := NewServer(c)
+	assert.NotPanics(t, func() { root.NewRouterGroup("").Mount("/", echo) })
+	assert.Equal(t, "path /", serve(root, "/"))
+	assert.Equal(t, "path /health", serve(root, "/health"))
+}
+
+type permissionMiddleware struct{}
+
+func (h *permissionMiddleware) Handle(req Request) (any, errors.ErrorModel) {
+	permission, ok := req.Route().Metadata.Get("permission")
+	if ok && req.GetHeader("X-Permission") != permission {
+		return nil, errors.DefaultForbiddenError
+	}
+	return nil, nil
+}
+
+func TestRouterGroup_Metadata(t *testing.T) {
+	respond := NewResponder(i18n.NewBundle(language.English))
+	c := NewController(respond, logger.NewLogger(logger.WarnLevel, logger.JsonEncoding))
+	s := NewServer(c)
+	rg := s.NewRouterGroup("api").WithMetadata("audit", true)
+	rg.Middleware(&permissionMiddleware{})
+	rg.Get("users", NewHelloHandler())
+	rg.Post("users", Meta("permission", "users.write"), Meta("audit", false), NewHelloHandler())
+
+	serve := func(method, permission string) int {
+		req, _ := http.NewRequest(method, "/api/users", nil)
+		req.Header.Set("X-Permission", permission)
+		req.Header.Set("Accept-Language", "en")
+		w := httptest.NewRecorder()
+		rg.ServeHttp(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, ""))
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPost, ""))
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "users.write"))
+
+	routes := s.Routes()
+	assert.Equal(t, Metadata{"audit": true}, routes[0].Metadata)
+	assert.Equal(t, Metadata{"audit": false, "permission": "users.write"}, routes[1].Metadata)
+	assert.Equal(t, []string{"*gateway.permissionMiddleware"}, routes[1].Middlewares)
+}
+
+type resultMiddleware struct{}
+
+func (h *resultMiddleware) Handle(req Request) (any, errors.ErrorModel) {
+	req.Writer().Header().Set("X-Middleware", "true")
+	return "middleware", nil
+}
+
+func TestRouterGroup_MiddlewareDoesNotRespond(t *testing.T) {
+	respond := NewResponder(i18n.NewBundle(language.English))
+	c := NewController(respond, logger.NewLogger(logger.WarnLevel, logger.JsonEncoding))
+	s := NewServer(c)
+	rg := s.NewRouterGroup("api")
+	rg.Middleware(NewMiddleware(), &resultMiddleware{})
+	rg.Get("users", NewHelloHandler())
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/users", nil)
+	req.Header.Set("Accept-Language", "en")
+	w := httptest.NewRecorder()
+	rg.ServeHttp(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "true", w.Header().Get("X-Middleware"))
+	assert.Contains(t, w.Body.String(), "saeed")
+	assert.NotContains(t, w.Body.String(), `"middleware"`)
+}
+
+func TestRouterGroup_Version(t *testing.T) {
+	respond := NewResponder(i18n.NewBundle(language.English))
+	c := NewController(respond, logger.NewLogger(logger.WarnLevel, logger.JsonEncoding))
+	s := NewServer(c)
+	rg := s.NewRouterGroup("api")
+	sunset := time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)
+	v1 := rg.Version("v1", DefaultVersion(), DeprecatedAt(sunset.AddDate(0, -6, 0)), SunsetAt(sunset))
+	v1.Get("users", NewHelloHandler())
+	v1.Get("status", NewHelloHandler())
+	v2 := rg.Version("v2")
+	v2.Get("users", NewHelloHandler())
+	v2.Get("admin", Meta("permission", "admin"), &permissionMiddleware{}, NewHelloHandler())
+	rg.Get("health", NewMiddleware())
+	rg.Get("status", NewMiddleware())
+
+	serve := func(path string, header map[string]string) (*httptest.ResponseRecorder, Response) {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		rg.ServeHttp(w, req)
+		var res Response
+		_ = json.NewDecoder(bytes.NewReader(w.Body.Bytes())).Decode(&res)
+		return w, res
+	}
+
+	w, res := serve("/api/v2/users", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "v2", res.Version)
+	assert.Empty(t, w.Header().Get("Deprecation"))
+
+	w, res = serve("/api/users", map[string]string{"Accept-Version": "2"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "v2", res.Version)
+
+	w, res = serve("/api/users", map[string]string{"Accept": "application/json; version=v2"})
+	assert.Equal(t, "v2", res.Version)
+
+	w, res = serve("/api/users", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "v1", res.Version)
+	assert.Equal(t, "Fri, 01 Jan 2027 00:00:00 GMT", w.Header().Get("Sunset"))
+	assert.NotEmpty(t, w.Header().Get("Deprecation"))
+
+	w, _ = serve("/api/health", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w, _ = serve("/api/users", map[string]string{"Accept-Version": "v9"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w, res = serve("/api/v2/admin", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, "v2", res.Version)
+
+	w, _ = serve("/api/status", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "saeed")
+	w, _ = serve("/api/v1/status", nil)
+	assert.Contains(t, w.Body.String(), "saeed")
+}
+
+type article struct {
+	Slug  string `json:"slug"`
+	Title string `json:"title"`
+}
+
+func (a article) ResourceType() string { return "articles" }
+func (a article) ResourceID() string   { return a.Slug }
+
+type articlesHandler struct{}
+
+func (h *articlesHandler) Handle(req Request) (any, errors.ErrorModel) {
+	return []article{{Slug: "hello", Title: "Hello"}}, nil
+}
+
+func TestRouterGroup_WithEnvelope(t *testing.T) {
+	respond := NewResponder(i18n.NewBundle(language.English), WithEnvelope(RawEnvelope()))
+	c := NewController(respond, logger.NewLogger(logger.WarnLevel, logger.JsonEncoding))
+	s := NewServer(c)
+	rg := s.NewRouterGroup("api")
+	rg.Get("raw", NewHelloHandler())
+	rg.WithEnvelope(JSONAPIEnvelope()).Get("jsonapi", NewHelloHandler())
+	rg.WithEnvelope(JSONAPIEnvelope()).Get("articles", &articlesHandler{})
+	problem := rg.Group("problem").WithEnvelope(ProblemEnvelope())
+	problem.Get("users", NewHelloHandler())
+	problem.Get("denied", NewErrorHandler())
+
+	serve := func(path string) (*httptest.ResponseRecorder, map[string]any) {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Language", "en")
+		w := httptest.NewRecorder()
+		rg.ServeHttp(w, req)
+		var body map[string]any
+		_ = json.Unmarshal(w.Body.Bytes(), &body)
+		return w, body
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/raw", nil)
+	rg.ServeHttp(w, req)
+	var users []map[string]any
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &users))
+	assert.Len(t, users, 2)
+
+	w, body := serve("/api/jsonapi")
+	assert.Equal(t, "application/vnd.api+json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Len(t, body["data"], 2)
+	assert.Contains(t, body, "meta")
+	assert.Equal(t, map[string]any{
+		"type":       "user",
+		"attributes": map[string]any{"name": "ali", "age": float64(25), "location": "turkey"},
+	}, body["data"].([]any)[0])
+
+	_, body = serve("/api/articles")
+	assert.Equal(t, []any{map[string]any{
+		"type":       "articles",
+		"id":         "hello",
+		"attributes": map[string]any{"slug": "hello", "title": "Hello"},
+	}}, body["data"])
+
+	w, body = serve("/api/problem/users")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "v1", body["version"])
+
+	w, body = serve("/api/problem/denied")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, "application/problem+json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, float64(http.StatusForbidden), body["status"])
+	assert.Equal(t, "/api/problem/denied", body["instance"])
+}
+
+type protoHandler struct{}
+
+func (h *protoHandler) Handle(req Request) (any, errors.ErrorModel) {
+	return wrapperspb.String("ali"), nil
+}
+
+type labelsHandler struct{}
+
+func (h *labelsHandler) Handle(req Request) (any, errors.ErrorModel) {
+	return map[string]any{"1st place": "gold"}, nil
+}
+
+func TestResponder_Negotiation(t *testing.T) {
+	respond := NewResponder(i18n.NewBundle(language.English), WithEncoder(XMLEncoder()), WithEncoder(YAMLEncoder()), WithEncoder(MsgPackEncoder()), WithEncoder(ProtobufEncoder()))
+	c := NewController(respond, logger.NewLogger(logger.WarnLevel, logger.JsonEncoding))
+	s := NewServer(c)
+	rg := s.NewRouterGroup("api")
+	rg.Get("users", NewHelloHandler())
+	rg.Get("proto", &protoHandler{})
+	rg.Get("labels", &labelsHandler{})
+	rg.Post("echo", &echoHandler{})
+
+	serve := func(method, path, accept, contentType, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Accept", accept)
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		rg.ServeHttp(w, req)
+		return w
+	}
+
+	w := serve(http.MethodGet, "/api/users", "application/xml", "", "")
+	assert.Equal(t, "application/xml; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "<name>ali</name>")
+
+	w = serve(http.MethodGet, "/api/users", "text/html;q=0.9, application/yaml", "", "")
+	assert.Equal(t, "application/yaml; charset=utf-8", w.Header().Get("Content-Type"))
+	var res Response
+	assert.NoError(t, yaml.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(t, "v1", res.Version)
+
+	w = serve(http.MethodGet, "/api/users", "application/msgpack", "", "")
+	assert.Equal(t, "application/msgpack", w.Header().Get("Content-Type"))
+	var decoded map[string]any
+	handle := &codec.MsgpackHandle{}
+	handle.RawToString = true
+	assert.NoError(t, codec.NewDecoderBytes(w.Body.Bytes(), handle).Decode(&decoded))
+	assert.Equal(t, "v1", decoded["version"])
+
+	w = serve(http.MethodGet, "/api/proto", "application/x-protobuf", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var message wrapperspb.StringValue
+	assert.NoError(t, proto.Unmarshal(w.Body.Bytes(), &message))
+	assert.Equal(t, "ali", message.GetValue())
+
+	w = serve(http.MethodGet, "/api/users", "application/x-protobuf", "", "")
+	assert.Equal(t, http.StatusNotAcceptable, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+
+	w = serve(http.MethodGet, "/api/users", "application/json;q=0, */*", "", "")
+	assert.Equal(t, "application/xml; charset=utf-8", w.Header().Get("Content-Type"))
+
+	w = serve(http.MethodPost, "/api/echo", "application/json", "application/xml", "<echo><name>saeed</name></echo>")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"saeed"`)
+
+	w = serve(http.MethodPost, "/api/echo", "application/json", "application/yaml", "name: reza")
+	assert.Contains(t, w.Body.String(), `"name":"reza"`)
+
+	w = serve(http.MethodGet, "/api/proto", "application/json", "", "")
+	assert.Contains(t, w.Body.String(), `"result":["ali"]`)
+
+	w = serve(http.MethodGet, "/api/labels", "application/xml", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "<_st_place>gold</_st_place>")
+
+	var person struct {
+		Name string   `json:"name"`
+		Age  int      `json:"age"`
+		Tags []string `json:"tags"`
+	}
+	assert.NoError(t, XMLEncoder().Decode(strings.NewReader("<person><name>ali</name><age>30</age><tags><item>a</item><item>b</item></tags></person>"), &person))
+	assert.Equal(t, "ali", person.Name)
+	assert.Equal(t, 30, person.Age)
+	assert.Equal(t, []string{"a", "b"}, person.Tags)
+	assert.Error(t, XMLEncoder().Decode(strings.NewReader("<person><age>old</age></person>"), &person))
+
+	var contact struct {
+		FirstName string `json:"first_name"`
+		Phones    []int  `json:"phones"`
+	}
+	assert.NoError(t, YAMLEncoder().Decode(strings.NewReader("first_name: ali\nphones: [1, 2]\n"), &contact))
+	assert.Equal(t, "ali", contact.FirstName)
+	assert.Equal(t, []int{1, 2}, contact.Phones)
+	var labels map[string]string
+	assert.NoError(t, YAMLEncoder().Decode(strings.NewReader("1: gold\n"), &labels))
+	assert.Equal(t, map[string]string{"1": "gold"}, labels)
+
+	binding.EnableDecoderDisallowUnknownFields = true
+	defer func() { binding.EnableDecoderDisallowUnknownFields = false }()
+	w = serve(http.MethodPost, "/api/echo", "application/json", "application/json", `{"name":"ali","age":30}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestResponder_DefaultEncoders(t *testing.T) {
+	respond := NewResponder(i18n.NewBundle(language.English))
+	c := NewController(respond, logger.NewLogger(logger.WarnLevel, logger.JsonEncoding))
+	s := NewServer(c)
+	rg := s.NewRouterGroup("api")
+	rg.Get("users", NewHelloHandler())
+
+	serve := func(accept string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, "/api/users", nil)
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		rg.ServeHttp(w, req)
+		return w
+	}
+
+	w := serve("text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+
+	w = serve("application/yaml")
+	assert.Equal(t, http.StatusNotAcceptable, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+}
+
+type profile struct {
+	Name string `json:"name"`
+}
+
+func (p profile) ResponseObject() {}
+
+type profileHandler struct{}
+
+func (h *profileHandler) Handle(req Request) (any, errors.ErrorModel) {
+	return profile{Name: "ali"}, nil
+}
+
+func TestResponder_Shape(t *testing.T) {
+	respond := NewResponder(i18n.NewBundle(language.English))
+	c := NewController(respond, logger.NewLogger(logger.WarnLevel, logger.JsonEncoding))
+	s := NewServer(c)
+	rg := s.NewRouterGroup("api")
+	rg.Get("legacy", &echoHandler{})
+	rg.Get("profile", &profileHandler{})
+	rg.Get("user", ResponseShape(ShapeObject), &echoHandler{})
+	rg.WithMetadata(ShapeKey, ShapeObject).Get("users", NewHelloHandler())
+
+	serve := func(path string) map[string]any {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		rg.ServeHttp(w, req)
+		var body map[string]any
+		_ = json.Unmarshal(w.Body.Bytes(), &body)
+		return body["data"].(map[string]any)
+	}
+
+	data := serve("/api/legacy")
+	assert.Equal(t, []any{map[string]any{"name": ""}}, data["result"])
+	assert.Contains(t, data, "total")
+
+	data = serve("/api/profile")
+	assert.Equal(t, map[string]any{"name": "ali"}, data["result"])
+	assert.NotContains(t, data, "total")
+
+	data = serve("/api/user")
+	assert.Equal(t, map[string]any{"name": ""}, data["result"])
+	assert.NotContains(t, data, "per_page")
+
+	data = serve("/api/users")
+	assert.Len(t, data["result"], 2)
+	assert.Contains(t, data, "total")
+}
+
+type nilHandler struct{}
+
+func (h *nilHandler) Handle(req Request) (any, errors.ErrorModel) {
+	return nil, nil
+}
+
+type acceptedHandler struct{}
+
+func (h *acceptedHandler) Handle(req Request) (any, errors.ErrorModel) {
+	req.SetStatusCode(http.StatusAccepted)
+	req.SetMessage("queued")
+	return profile{Name: "ali"}, nil
+}
+
+func TestResponder_StatusPolicy(t *testing.T) {
+	respond := NewResponder(i18n.NewBundle(language.English), WithStatusPolicy(MethodStatusPolicy))
+	c := NewController(respond, logger.NewLogger(logger.WarnLevel, logger.JsonEncoding))
+	s := NewServer(c)
+	rg := s.NewRouterGroup("api")
+	rg.Get("users", NewHelloHandler())
+	rg.Post("users", &profileHandler{})
+	rg.Put("users", &profileHandler{})
+	rg.Delete("users", &nilHandler{})
+	rg.Post("jobs", &acceptedHandler{})
+
+	serve := func(method, path string) (*httptest.ResponseRecorder, ObjectResponse) {
+		req, _ := http.NewRequest(method, path, nil)
+		req.Header.Set("Accept-Language", "en")
+		w := httptest.NewRecorder()
+		rg.ServeHttp(w, req)
+		var res ObjectResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &res)
+		return w, res
+	}
+
+	w, _ := serve(http.MethodGet, "/api/users")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w, res := serve(http.MethodPost, "/api/users")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "Item has been created successfully.", res.Message)
+
+	w, res = serve(http.MethodPut, "/api/users")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Item has been updated successfully.", res.Message)
+
+	w, _ = serve(http.MethodDelete, "/api/users")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	w, res = serve(http.MethodPost, "/api/jobs")
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, "queued", res.Message)
+}
+
+type eventsHandler struct{}
+
+func (h *eventsHandler) Handle(req Request) (any, errors.ErrorModel) {
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		events <- Event{ID: "1", Name: "greeting", Data: "hello\nworld"}
+		time.Sleep(30 * time.Millisecond)
+		events <- Event{ID: "2", Data: greeting{Text: "bye"}}
+	}()
+	_ = req.SendEvents(events, 10*time.Millisecond)
+	return nil, nil
+}
+
+type ndjsonHandler struct{}
+
+func (h *ndjsonHandler) Handle(req Request) (any, errors.ErrorModel) {
+	users := make(chan greeting, 3)
+	for _, name := range []string{"ali", "saeed", "reza"} {
+		users <- greeting{Text: name}
+	}
+	close(users)
+	if err := req.StreamJSON(FromChannel(req.GetContext(), users)); err != nil {
+		return nil, errors.DefaultServiceUnAvaialable.WithError(err)
+	}
+	return nil, nil
+}
+
+type downloadHandler struct{}
+
+func (h *downloadHandler) Handle(req Request) (any, errors.ErrorModel) {
+	if req.GetParam("kind") == "reader" {
+		_ = req.Download("report.csv", io.MultiReader(strings.NewReader("a,b\n")), time.Time{})
+		return nil, nil
+	}
+	_ = req.Download("report.txt", strings.NewReader("0123456789"), time.Now())
+	return nil, nil
+}
+
+func TestRequest_Streaming(t *testing.T) {
+	respond := NewResponder(i18n.NewBundle(language.English))
+	c := NewController(respond, logger.NewLogger(logger.WarnLevel, logger.JsonEncoding))
+	s := NewServer(c)
+	rg := s.NewRouterGroup("api")
+	rg.Get("events", &eventsHandler{})
+	rg.Get("users", &ndjsonHandler{})
+	rg.Get("download/:kind", &downloadHandler{})
+	ts := httptest.NewServer(http.HandlerFunc(rg.ServeHttp))
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/api/events")
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+	assert.Contains(t, string(body), "id: 1\nevent: greeting\ndata: hello\ndata: world\n\n")
+	assert.Contains(t, string(body), ": ping\n\n")
+	assert.Contains(t, string(body), "id: 2\ndata: {\"text\":\"bye\"}\n\n")
+
+	res, err = http.Get(ts.URL + "/api/users")
+	assert.NoError(t, err)
+	body, _ = io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	assert.Equal(t, "application/x-ndjson", res.Header.Get("Content-Type"))
+	assert.Equal(t, "{\"text\":\"ali\"}\n{\"text\":\"saeed\"}\n{\"text\":\"reza\"}\n", string(body))
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/download/seeker", nil)
+	req.Header.Set("Range", "bytes=2-4")
+	res, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	body, _ = io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusPartialContent, res.StatusCode)
+	assert.Equal(t, "234", string(body))
+	assert.Equal(t, `attachment; filename=report.txt`, res.Header.Get("Content-Disposition"))
+
+	res, err = http.Get(ts.URL + "/api/download/reader")
+	assert.NoError(t, err)
+	body, _ = io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	assert.Equal(t, "a,b\n", string(body))
+	assert.Equal(t, "none", res.Header.Get("Accept-Ranges"))
+}
+
+func TestWriteEvent(t *testing.T) {
+	var b strings.Builder
+	assert.NoError(t, writeEvent(&b, Event{ID: "1", Data: "a\r\nb\rc\nd"}))
+	assert.Equal(t, "id: 1\ndata: a\ndata: b\ndata: c\ndata: d\n\n", b.String())
+
+	for _, event := range []Event{{ID: "1\nevent: admin"}, {ID: "1\r"}, {Name: "greeting\r\ndata: forged"}} {
+		b.Reset()
+		assert.Error(t, writeEvent(&b, event))
+		assert.Empty(t, b.String())
+	}
+}
+
+func TestRouterGroup_WebSocket(t *testing.T) {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := l.Addr().String()
+	_ = l.Close()
+
+	respond := NewResponder(i18n.NewBundle(language.English))
+	c := NewController(respond, logger.NewLogger(logger.WarnLevel, logger.JsonEncoding))
+	s := NewServer(c)
+	rg := s.NewRouterGroup("api")
+	rg.Middleware(&permissionMiddleware{})
+	rg.WebSocket("chat", Meta("permission", "chat"), NewWebSocketHandler(func(conn *WebSocketConn, req Request) errors.ErrorModel {
+		for {
+			var in greeting
+			if err := conn.ReadJSON(&in); err != nil {
+				return nil
+			}
+			if err := conn.WriteJSON(greeting{Text: strings.ToUpper(in.Text)}); err != nil {
+				return nil
+			}
+		}
+	}, WithPingInterval(20*time.Millisecond)))
+
+	go func() { _ = s.Run(addr) }()
+	url := "ws://" + addr + "/api/chat"
+	assert.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			_ = conn.Close()
+		}
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	_, res, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://"+addr+"/api/chat", nil)
+	req.Header.Set("X-Permission", "chat")
+	res, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"X-Permission": {"chat"}})
+	assert.NoError(t, err)
+	pings := make(chan struct{}, 10)
+	conn.SetPingHandler(func(data string) error {
+		pings <- struct{}{}
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+	assert.NoError(t, conn.WriteJSON(greeting{Text: "hello"}))
+	var out greeting
+	assert.NoError(t, conn.ReadJSON(&out))
+	assert.Equal(t, "HELLO", out.Text)
+
+	readErr := make(chan error, 1)
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+	select {
+	case <-pings:
+	case <-time.After(time.Second):
+		t.Fatal("no ping received")
+	}
+
+	assert.NoError(t, s.Shutdown(time.Second))
+	select {
+	case err = <-readErr:
+		assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway))
+	case <-time.After(time.Second):
+		t.Fatal("connection not closed on shutdown")
+	}
+}
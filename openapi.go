@@ -0,0 +1,616 @@
+package gateway
+
+import (
+	errors "github.com/haderianous/go-error"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RouteDoc describes a route for the generated OpenAPI document. Request and
+// Response take a zero value of the types the handler binds and returns.
+type RouteDoc struct {
+	Summary     string
+	Description string
+	Tags        []string
+	Request     Validatable
+	Response    any
+	// Status is the status of successful responses, 200 when zero.
+	Status int
+	// Errors lists the errors the handler returns, the ones the gateway
+	// answers with on its own (validation, body limit, timeout...) are
+	// added.
+	Errors []errors.ErrorModel
+	// Filterable documents the page, limit, filters[...] and sorts[...] query
+	// parameters read by BindFilters, routes with a FilterSchema always are.
+	Filterable bool
+}
+
+type OpenAPIInfo struct {
+	Title       string
+	Description string
+	Version     string
+	Servers     []string
+}
+
+type documentedHandler struct {
+	Handler
+	doc RouteDoc
+}
+
+// Document attaches doc to handler, register the result as the last handler
+// of a route to have the route described by OpenAPI.
+func Document(handler Handler, doc RouteDoc) Handler {
+	return &documentedHandler{Handler: handler, doc: doc}
+}
+
+// OpenAPI builds an OpenAPI 3 document out of the routes registered on
+// server. Bodies are described in the formats of the Responder encoders and
+// the shape of the envelope of every route.
+func OpenAPI(server Server, info OpenAPIInfo) map[string]any {
+	var responder Responder = NewResponder(nil)
+	if s, ok := server.(interface{ responder() Responder }); ok {
+		responder = s.responder()
+	}
+	encoders := responder.Encoders()
+	paths := map[string]any{}
+	for _, route := range server.Routes() {
+		// OpenAPI has no CONNECT operation
+		if route.Method == http.MethodConnect {
+			continue
+		}
+		path, pathParams := openAPIPath(route.Path)
+		item, ok := paths[path].(map[string]any)
+		if !ok {
+			item = map[string]any{}
+			paths[path] = item
+		}
+		item[strings.ToLower(route.Method)] = operation(route, pathParams, route.envelopeOr(responder.Envelope()), encoders)
+	}
+
+	var servers []any
+	for _, url := range info.Servers {
+		servers = append(servers, map[string]any{"url": url})
+	}
+	doc := map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       info.Title,
+			"description": info.Description,
+			"version":     info.Version,
+		},
+		"paths": paths,
+	}
+	if len(servers) > 0 {
+		doc["servers"] = servers
+	}
+	return doc
+}
+
+type openAPIHandler struct {
+	server Server
+	info   OpenAPIInfo
+}
+
+// NewOpenAPIHandler serves the OpenAPI document of server as plain JSON, the
+// route it is registered on is the path the document is published at.
+func NewOpenAPIHandler(server Server, info OpenAPIInfo) Handler {
+	return &openAPIHandler{server: server, info: info}
+}
+
+func (h *openAPIHandler) Handle(req Request) (any, errors.ErrorModel) {
+	req.GinContext().JSON(http.StatusOK, OpenAPI(h.server, h.info))
+	req.SetIsResponded(true)
+	return nil, nil
+}
+
+// openAPIPath turns gin params (:id, *path) into OpenAPI ones ({id}).
+func openAPIPath(path string) (string, []string) {
+	var params []string
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, ":") || strings.HasPrefix(part, "*") {
+			params = append(params, part[1:])
+			parts[i] = "{" + part[1:] + "}"
+		}
+	}
+	return strings.Join(parts, "/"), params
+}
+
+func operation(route RouteInfo, pathParams []string, envelope Envelope, encoders []Encoder) map[string]any {
+	doc := RouteDoc{}
+	if route.doc != nil {
+		doc = *route.doc
+	}
+	op := map[string]any{
+		"operationId": strings.ToLower(route.Method) + strings.NewReplacer("/", "_", ":", "", "*", "").Replace(route.Path),
+	}
+	if doc.Summary != "" {
+		op["summary"] = doc.Summary
+	}
+	if doc.Description != "" {
+		op["description"] = doc.Description
+	}
+	if len(doc.Tags) > 0 {
+		op["tags"] = doc.Tags
+	}
+
+	params := map[string]map[string]any{}
+	for _, name := range pathParams {
+		params["path:"+name] = parameter(name, "path", true, map[string]any{"type": "string"})
+	}
+	var body map[string]any
+	if doc.Request != nil {
+		body = requestParameters(reflect.TypeOf(doc.Request), params)
+	}
+	filters, hasSchema := route.Metadata.Get(FilterSchemaKey)
+	if doc.Filterable || hasSchema {
+		filterSchema, _ := filters.(FilterSchema)
+		for _, p := range filterParameters(filterSchema) {
+			params["query:"+p["name"].(string)] = p
+		}
+	}
+	if len(params) > 0 {
+		keys := make([]string, 0, len(params))
+		for k := range params {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		list := make([]any, 0, len(keys))
+		for _, k := range keys {
+			list = append(list, params[k])
+		}
+		op["parameters"] = list
+	}
+	if body != nil {
+		op["requestBody"] = map[string]any{
+			"required": true,
+			"content":  content(encoders, doc.Request, "", body),
+		}
+	}
+
+	var result map[string]any
+	object := false
+	if doc.Response != nil {
+		t := reflect.TypeOf(doc.Response)
+		if t.Kind() == reflect.Slice {
+			t = t.Elem()
+		} else {
+			shape, _ := route.Metadata.Get(ShapeKey)
+			_, isObject := doc.Response.(Object)
+			object = isObject || shape == ShapeObject
+		}
+		result = schemaOf(t, map[reflect.Type]bool{})
+	}
+
+	status := doc.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := map[string]any{"description": http.StatusText(status)}
+	if status != http.StatusNoContent && status != http.StatusNotModified {
+		success["content"] = successContent(envelope, encoders, doc.Response, result, object)
+	}
+	responses := map[string]any{strconv.Itoa(status): success}
+	failure := failureContent(envelope, encoders)
+	for _, status := range errorStatuses(route, doc, hasSchema || doc.Filterable) {
+		responses[strconv.Itoa(status)] = map[string]any{
+			"description": http.StatusText(status),
+			"content":     failure,
+		}
+	}
+	op["responses"] = responses
+	return op
+}
+
+// successContent describes the successful bodies of envelope for every
+// encoder able to write them, or the bare result for the encoders only able
+// to write that.
+func successContent(envelope Envelope, encoders []Encoder, response any, result map[string]any, object bool) map[string]any {
+	if result == nil {
+		result = map[string]any{}
+	}
+	schema, contentType := map[string]any{}, ""
+	if documented, ok := envelope.(DocumentedEnvelope); ok {
+		schema, contentType = documented.SuccessSchema(result, object)
+	}
+	var body any = map[string]any{}
+	if _, bare := envelope.(rawEnvelope); bare {
+		body = response
+	}
+	bare := result
+	if !object {
+		bare = map[string]any{"type": "array", "items": result}
+	}
+	media := map[string]any{}
+	for _, e := range encoders {
+		switch {
+		case e.Supports(body):
+			media[mediaTypeOf(e, contentType)] = map[string]any{"schema": schema}
+		case response != nil && e.Supports(response):
+			media[e.MediaTypes()[0]] = map[string]any{"schema": bare}
+		}
+	}
+	return media
+}
+
+// failureContent describes the error bodies of envelope, written by the
+// first encoder when none supports them, as the Responder does.
+func failureContent(envelope Envelope, encoders []Encoder) map[string]any {
+	schema, contentType := map[string]any{}, ""
+	if documented, ok := envelope.(DocumentedEnvelope); ok {
+		schema, contentType = documented.FailureSchema()
+	}
+	media := content(encoders, map[string]any{}, contentType, schema)
+	if len(media) == 0 && len(encoders) > 0 {
+		media[mediaTypeOf(encoders[0], contentType)] = map[string]any{"schema": schema}
+	}
+	return media
+}
+
+// content gives schema to the media types of the encoders supporting body.
+func content(encoders []Encoder, body any, contentType string, schema map[string]any) map[string]any {
+	media := map[string]any{}
+	for _, e := range encoders {
+		if e.Supports(body) {
+			media[mediaTypeOf(e, contentType)] = map[string]any{"schema": schema}
+		}
+	}
+	return media
+}
+
+// errorStatuses lists the statuses of the errors route answers with: the
+// ones of doc and the ones raised by the gateway for the route's request,
+// filters, body limit and timeout.
+func errorStatuses(route RouteInfo, doc RouteDoc, filterable bool) []int {
+	errs := append([]errors.ErrorModel{DefaultNotAcceptableError}, doc.Errors...)
+	if doc.Request != nil {
+		errs = append(errs, errors.DefaultUnProcessable)
+	}
+	if filterable {
+		errs = append(errs, DefaultInvalidQueryError, errors.DefaultUnProcessable)
+	}
+	switch route.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+		if route.bodyLimit > 0 {
+			errs = append(errs, DefaultEntityTooLargeError)
+		}
+	}
+	if route.timeout > 0 {
+		errs = append(errs, DefaultTimeoutError)
+	}
+	seen := map[int]bool{}
+	var statuses []int
+	for _, err := range errs {
+		status := getStatusCodeByError(err.Type())
+		if !seen[status] {
+			seen[status] = true
+			statuses = append(statuses, status)
+		}
+	}
+	sort.Ints(statuses)
+	return statuses
+}
+
+func parameter(name, in string, required bool, schema map[string]any) map[string]any {
+	return map[string]any{"name": name, "in": in, "required": required, "schema": schema}
+}
+
+// requestParameters adds the uri, form and header bound fields of a request
+// type to params and returns the schema of its json body, if it has one.
+func requestParameters(t reflect.Type, params map[string]map[string]any) map[string]any {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	body := map[string]any{"type": "object"}
+	properties := map[string]any{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		isRequired := strings.Contains(f.Tag.Get("binding"), "required")
+		schema := schemaOf(f.Type, map[reflect.Type]bool{})
+		bound := false
+		for _, loc := range []struct{ tag, in string }{{"uri", "path"}, {"form", "query"}, {"header", "header"}} {
+			name := tagName(f.Tag.Get(loc.tag))
+			if name == "" {
+				continue
+			}
+			bound = true
+			params[loc.in+":"+name] = parameter(name, loc.in, isRequired || loc.in == "path", schema)
+		}
+		name := tagName(f.Tag.Get("json"))
+		if name == "" && !bound {
+			name = f.Name
+		}
+		if name == "" {
+			continue
+		}
+		properties[name] = schema
+		if isRequired {
+			required = append(required, name)
+		}
+	}
+	if len(properties) == 0 {
+		return nil
+	}
+	body["properties"] = properties
+	if len(required) > 0 {
+		body["required"] = required
+	}
+	return body
+}
+
+func tagName(tag string) string {
+	name := strings.Split(tag, ",")[0]
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func schemaOf(t reflect.Type, seen map[reflect.Type]bool) map[string]any {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": schemaOf(t.Elem(), seen)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaOf(t.Elem(), seen)}
+	case reflect.Struct:
+		if seen[t] {
+			return map[string]any{"type": "object"}
+		}
+		seen[t] = true
+		defer delete(seen, t)
+		properties := map[string]any{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name := f.Name
+			if tag := f.Tag.Get("json"); tag != "" {
+				name = tagName(tag)
+			}
+			if name == "" {
+				continue
+			}
+			properties[name] = schemaOf(f.Type, seen)
+		}
+		return map[string]any{"type": "object", "properties": properties}
+	}
+	return map[string]any{}
+}
+
+func (defaultEnvelope) SuccessSchema(result map[string]any, object bool) (map[string]any, string) {
+	data := map[string]any{"type": "object", "properties": map[string]any{"result": result}}
+	if !object {
+		data["properties"] = map[string]any{
+			"total":       map[string]any{"type": "integer"},
+			"per_page":    map[string]any{"type": "integer"},
+			"next_cursor": map[string]any{"type": "string"},
+			"prev_cursor": map[string]any{"type": "string"},
+			"result":      map[string]any{"type": "array", "items": result},
+		}
+	}
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"message":        map[string]any{"type": "string"},
+			"error":          map[string]any{"type": "string"},
+			"version":        map[string]any{"type": "string"},
+			"represented_at": map[string]any{"type": "string"},
+			"data":           data,
+		},
+	}, ""
+}
+
+func (defaultEnvelope) FailureSchema() (map[string]any, string) {
+	return errorModelSchema(), ""
+}
+
+func (rawEnvelope) SuccessSchema(result map[string]any, object bool) (map[string]any, string) {
+	if object {
+		return result, ""
+	}
+	return map[string]any{"type": "array", "items": result}, ""
+}
+
+func (rawEnvelope) FailureSchema() (map[string]any, string) {
+	return errorModelSchema(), ""
+}
+
+func (jsonAPIEnvelope) SuccessSchema(result map[string]any, object bool) (map[string]any, string) {
+	data := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"type":       map[string]any{"type": "string"},
+			"id":         map[string]any{"type": "string"},
+			"attributes": result,
+		},
+	}
+	meta := map[string]any{
+		"message": map[string]any{"type": "string"},
+		"version": map[string]any{"type": "string"},
+	}
+	if !object {
+		data = map[string]any{"type": "array", "items": data}
+		meta["total"] = map[string]any{"type": "integer"}
+		meta["per_page"] = map[string]any{"type": "integer"}
+		meta["next_cursor"] = map[string]any{"type": "string"}
+		meta["prev_cursor"] = map[string]any{"type": "string"}
+	}
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"data": data,
+			"meta": map[string]any{"type": "object", "properties": meta},
+		},
+	}, jsonAPIContentType
+}
+
+func (jsonAPIEnvelope) FailureSchema() (map[string]any, string) {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"errors": map[string]any{
+				"type": "array",
+				"items": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"status": map[string]any{"type": "string"},
+						"code":   map[string]any{"type": "string"},
+						"title":  map[string]any{"type": "string"},
+						"detail": map[string]any{"type": "string"},
+						"source": map[string]any{
+							"type":       "object",
+							"properties": map[string]any{"pointer": map[string]any{"type": "string"}},
+						},
+					},
+				},
+			},
+		},
+	}, jsonAPIContentType
+}
+
+func (problemEnvelope) FailureSchema() (map[string]any, string) {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"type":     map[string]any{"type": "string"},
+			"title":    map[string]any{"type": "string"},
+			"status":   map[string]any{"type": "integer"},
+			"detail":   map[string]any{"type": "string"},
+			"code":     map[string]any{"type": "string"},
+			"instance": map[string]any{"type": "string"},
+			"errors":   fieldErrorsSchema(),
+		},
+	}, problemContentType
+}
+
+// errorModelSchema describes an errors.ErrorModel as it is rendered.
+func errorModelSchema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"code":           map[string]any{"type": "integer"},
+			"message":        map[string]any{"type": "string"},
+			"error":          map[string]any{"type": "string"},
+			"version":        map[string]any{"type": "string"},
+			"represented_at": map[string]any{"type": "string"},
+			"data": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"total":    map[string]any{"type": "integer"},
+					"per_page": map[string]any{"type": "integer"},
+					"result":   fieldErrorsSchema(),
+				},
+			},
+		},
+	}
+}
+
+func fieldErrorsSchema() map[string]any {
+	return map[string]any{
+		"type": "array",
+		"items": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"field": map[string]any{"type": "string"},
+				"error": map[string]any{},
+			},
+		},
+	}
+}
+
+// filterParameters describes the parameters read by BindFilters, with the
+// keys limited to those of schema when it has fields.
+func filterParameters(schema FilterSchema) []map[string]any {
+	operations := make([]string, 0, len(Operations))
+	for _, op := range Operations {
+		operations = append(operations, string(op))
+	}
+	filterKey := map[string]any{"type": "string"}
+	sortKey := map[string]any{"type": "string"}
+	if len(schema.Fields) > 0 {
+		var keys, sortable []string
+		for key, field := range schema.Fields {
+			keys = append(keys, key)
+			if field.Sortable && !(field.Nullable && schema.Cursors != nil) {
+				sortable = append(sortable, key)
+			}
+		}
+		sort.Strings(keys)
+		sort.Strings(sortable)
+		filterKey["enum"] = keys
+		if len(sortable) > 0 {
+			sortKey["enum"] = sortable
+		}
+	}
+	filter := parameter("filters", "query", false, map[string]any{
+		"type": "array",
+		"items": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"k":  filterKey,
+				"op": map[string]any{"type": "string", "enum": operations},
+				"v":  map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+				"g":  map[string]any{"type": "string"},
+			},
+		},
+	})
+	filter["style"] = "deepObject"
+	filter["explode"] = true
+	filter["description"] = "Filters as filters[i][k]=key&filters[i][op]=eq&filters[i][v]=value, repeat v for multiple values. Filters sharing filters[i][g] are OR'ed, everything else is AND'ed."
+
+	sorts := parameter("sorts", "query", false, map[string]any{
+		"type": "array",
+		"items": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"k": sortKey,
+				"v": map[string]any{"type": "string", "enum": []string{"asc", "desc"}},
+			},
+		},
+	})
+	sorts["style"] = "deepObject"
+	sorts["explode"] = true
+	sorts["description"] = "Sorts as sorts[i][k]=key&sorts[i][v]=asc."
+
+	params := []map[string]any{
+		parameter("page", "query", false, map[string]any{"type": "integer", "minimum": 1}),
+		parameter("limit", "query", false, map[string]any{"type": "integer", "minimum": 1}),
+		filter,
+		sorts,
+	}
+	if schema.Cursors != nil {
+		cursor := parameter("cursor", "query", false, map[string]any{"type": "string"})
+		cursor["description"] = "Opaque next_cursor or prev_cursor of a previous response, replaces page and sorts."
+		params = append(params, cursor)
+	}
+	return params
+}
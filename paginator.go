@@ -7,12 +7,19 @@ type Paginator interface {
 	SetLimit(int)
 	Total() int
 	SetTotal(int)
+	// NextCursor and PrevCursor locate the neighbouring pages of keyset
+	// pagination, they are empty when there is no such page.
+	NextCursor() string
+	PrevCursor() string
+	SetCursors(next, prev string)
 }
 
 type paginator struct {
 	limit int
 	page  int
 	total int
+	next  string
+	prev  string
 }
 
 func NewPaginator() Paginator {
@@ -48,3 +55,15 @@ func (p *paginator) Total() int {
 func (p *paginator) SetTotal(total int) {
 	p.total = total
 }
+
+func (p *paginator) NextCursor() string {
+	return p.next
+}
+
+func (p *paginator) PrevCursor() string {
+	return p.prev
+}
+
+func (p *paginator) SetCursors(next, prev string) {
+	p.next, p.prev = next, prev
+}
@@ -0,0 +1,144 @@
+package gateway
+
+import (
+	"context"
+	stderrors "errors"
+	errors "github.com/haderianous/go-error"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+)
+
+type ProxyOption func(p *proxyHandler)
+
+type proxyHandler struct {
+	upstream    *url.URL
+	balancer    Balancer
+	stripPrefix string
+	transport   http.RoundTripper
+}
+
+// NewProxyHandler returns a Handler that forwards the request to the upstream
+// and writes its status, headers and body back unchanged.
+func NewProxyHandler(upstream *url.URL, opts ...ProxyOption) Handler {
+	p := &proxyHandler{upstream: upstream}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// NewBalancedProxyHandler works like NewProxyHandler but asks the balancer for
+// the upstream instance of every request.
+func NewBalancedProxyHandler(balancer Balancer, opts ...ProxyOption) Handler {
+	p := &proxyHandler{balancer: balancer}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// WithStripPrefix removes the given prefix from the request path before it is
+// joined to the upstream path.
+func WithStripPrefix(prefix string) ProxyOption {
+	return func(p *proxyHandler) {
+		p.stripPrefix = prefix
+	}
+}
+
+// WithTransport sets the round tripper used to reach the upstream.
+func WithTransport(transport http.RoundTripper) ProxyOption {
+	return func(p *proxyHandler) {
+		p.transport = transport
+	}
+}
+
+func (p *proxyHandler) Handle(req Request) (any, errors.ErrorModel) {
+	target := p.upstream
+	if p.balancer != nil {
+		upstream, done, ok := p.balancer.Next()
+		if !ok {
+			return nil, errors.DefaultServiceUnAvaialable
+		}
+		defer done()
+		target = upstream
+	}
+
+	var proxyErr error
+	rp := &httputil.ReverseProxy{
+		Director:  p.director(req.Request(), target),
+		Transport: p.transport,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			proxyErr = err
+		},
+	}
+	rp.ServeHTTP(req.Writer(), req.Request())
+	if proxyErr != nil {
+		return nil, upstreamError(proxyErr)
+	}
+	req.SetIsResponded(true)
+	return nil, nil
+}
+
+// upstreamError answers 413 when the request body went over its limit, 504
+// when the upstream timed out and 502 when it failed otherwise.
+func upstreamError(err error) errors.ErrorModel {
+	var tooLarge *http.MaxBytesError
+	if stderrors.As(err, &tooLarge) {
+		return DefaultEntityTooLargeError
+	}
+	var netErr net.Error
+	if stderrors.Is(err, context.DeadlineExceeded) || (stderrors.As(err, &netErr) && netErr.Timeout()) {
+		return DefaultGatewayTimeoutError.WithError(err)
+	}
+	return DefaultBadGatewayError.WithError(err)
+}
+
+func (p *proxyHandler) director(in *http.Request, upstream *url.URL) func(*http.Request) {
+	host := in.Host
+	proto := "http"
+	if in.TLS != nil {
+		proto = "https"
+	}
+	prefix := (&url.URL{Path: p.stripPrefix}).EscapedPath()
+	return func(out *http.Request) {
+		// work on the escaped path so encoded slashes survive
+		rawPath := joinURLPath(upstream.EscapedPath(), strings.TrimPrefix(out.URL.EscapedPath(), prefix))
+		out.URL.Scheme = upstream.Scheme
+		out.URL.Host = upstream.Host
+		// escaped paths always unescape
+		out.URL.Path, _ = url.PathUnescape(rawPath)
+		out.URL.RawPath = rawPath
+		if upstream.RawQuery == "" || out.URL.RawQuery == "" {
+			out.URL.RawQuery = upstream.RawQuery + out.URL.RawQuery
+		} else {
+			out.URL.RawQuery = upstream.RawQuery + "&" + out.URL.RawQuery
+		}
+		out.Host = upstream.Host
+		out.Header.Set("X-Forwarded-Host", host)
+		out.Header.Set("X-Forwarded-Proto", proto)
+		if p.stripPrefix != "" {
+			out.Header.Set("X-Forwarded-Prefix", p.stripPrefix)
+		}
+	}
+}
+
+func joinURLPath(a, b string) string {
+	if b == "" {
+		if a == "" {
+			return "/"
+		}
+		return a
+	}
+	aSlash := strings.HasSuffix(a, "/")
+	bSlash := strings.HasPrefix(b, "/")
+	switch {
+	case aSlash && bSlash:
+		return a + b[1:]
+	case !aSlash && !bSlash:
+		return a + "/" + b
+	}
+	return a + b
+}
@@ -0,0 +1,134 @@
+package gateway
+
+import (
+	"fmt"
+	errors "github.com/haderianous/go-error"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+)
+
+// likeEscape is portable across databases, unlike the backslash.
+const likeEscape = "!"
+
+var likeReplacer = strings.NewReplacer(likeEscape, likeEscape+likeEscape, "%", likeEscape+"%", "_", likeEscape+"_")
+
+// Apply narrows db, whose model must be set, to the filters and sorts of p,
+// counts the matching rows into the Paginator and selects the current page.
+// Columns only come from schema and every value is bound as a parameter.
+// The Paginator is the one of the request p was bound by, or a new one made
+// from Page and Limit for hand built params.
+func (p FilterParams) Apply(db *gorm.DB, schema FilterSchema) (*gorm.DB, Paginator, errors.ErrorModel) {
+	db, e := p.where(db, schema)
+	if e != nil {
+		return nil, nil, e
+	}
+	columns, paramErr := schema.keyColumns(p.Sorts)
+	if paramErr != nil {
+		return nil, nil, paramErr.errorModel(p.language)
+	}
+
+	paginator := p.pager()
+	var total int64
+	if err := db.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, nil, errors.DefaultServiceUnAvaialable.WithError(err)
+	}
+	paginator.SetTotal(int(total))
+
+	if len(columns) > 0 {
+		db = db.Clauses(orderBy(columns, false))
+	}
+	limit := paginator.PerPage()
+	return db.Limit(limit).Offset((paginator.Page() - 1) * limit), paginator, nil
+}
+
+// where narrows db to the filters of p.
+func (p FilterParams) where(db *gorm.DB, schema FilterSchema) (*gorm.DB, errors.ErrorModel) {
+	var where []clause.Expression
+	for _, group := range p.Groups() {
+		exprs := make([]clause.Expression, 0, len(group))
+		for _, f := range group {
+			field, ok := schema.Fields[f.Key]
+			if !ok {
+				return nil, unknownFilterKey(f.Key).errorModel(p.language)
+			}
+			if !f.Op.Valid() {
+				return nil, p.fieldError(f.Key, "UnknownFilterOperation", "{{.Param}} is not a supported operation.")
+			}
+			if !field.allows(f.Op) {
+				return nil, operationNotAllowed(f.Key).errorModel(p.language)
+			}
+			expr, err := filterExpression(clause.Column{Name: field.Column}, f)
+			if err != nil {
+				return nil, p.fieldError(f.Key, "InvalidFilterValues", "{{.Param}} has the wrong number of values for the operation.")
+			}
+			exprs = append(exprs, expr)
+		}
+		if len(exprs) == 1 {
+			where = append(where, exprs[0])
+		} else {
+			where = append(where, clause.Or(exprs...))
+		}
+	}
+	if len(where) > 0 {
+		db = db.Clauses(clause.Where{Exprs: where})
+	}
+	return db, nil
+}
+
+// pager returns the Paginator of p, made from Page and Limit when p was not
+// bound by a request.
+func (p FilterParams) pager() Paginator {
+	if p.paginator != nil {
+		return p.paginator
+	}
+	paginator := NewPaginator()
+	paginator.SetPage(p.Page)
+	paginator.SetLimit(p.Limit)
+	return paginator
+}
+
+func filterExpression(column clause.Column, f Filter) (clause.Expression, error) {
+	least, most := f.Op.arity()
+	if n := len(f.Value); n < least || (most >= 0 && n > most) {
+		return nil, fmt.Errorf("gateway: %s takes %d values", f.Op, n)
+	}
+	switch f.Op {
+	case Eq:
+		return clause.Eq{Column: column, Value: f.Value[0]}, nil
+	case NotEq:
+		return clause.Neq{Column: column, Value: f.Value[0]}, nil
+	case Gt:
+		return clause.Gt{Column: column, Value: f.Value[0]}, nil
+	case Gte:
+		return clause.Gte{Column: column, Value: f.Value[0]}, nil
+	case Lt:
+		return clause.Lt{Column: column, Value: f.Value[0]}, nil
+	case Lte:
+		return clause.Lte{Column: column, Value: f.Value[0]}, nil
+	case In:
+		return clause.IN{Column: column, Values: f.Value}, nil
+	case NotIn:
+		return clause.Not(clause.IN{Column: column, Values: f.Value}), nil
+	case Bt:
+		return clause.Expr{SQL: "? BETWEEN ? AND ?", Vars: []interface{}{column, f.Value[0], f.Value[1]}}, nil
+	case Ct, StartsWith, EndsWith:
+		pattern := likeReplacer.Replace(fmt.Sprint(f.Value[0]))
+		if f.Op != StartsWith {
+			pattern = "%" + pattern
+		}
+		if f.Op != EndsWith {
+			pattern += "%"
+		}
+		return clause.Expr{SQL: "? LIKE ? ESCAPE '" + likeEscape + "'", Vars: []interface{}{column, pattern}}, nil
+	case IsNull:
+		return clause.Expr{SQL: "? IS NULL", Vars: []interface{}{column}}, nil
+	case NotNull:
+		return clause.Expr{SQL: "? IS NOT NULL", Vars: []interface{}{column}}, nil
+	}
+	return nil, fmt.Errorf("gateway: unknown operation %q", f.Op)
+}
+
+func (p FilterParams) fieldError(key, messageId, message string) errors.ErrorModel {
+	return (&paramError{param: key, messageId: messageId, message: message}).errorModel(p.language)
+}
@@ -0,0 +1,107 @@
+package gateway
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+	"strings"
+	"testing"
+)
+
+// dryRunDialector builds SQL without a database.
+type dryRunDialector struct{}
+
+func (dryRunDialector) Name() string { return "dryrun" }
+
+func (dryRunDialector) Initialize(db *gorm.DB) error {
+	callbacks.RegisterDefaultCallbacks(db, &callbacks.Config{})
+	return nil
+}
+
+func (dryRunDialector) Migrator(db *gorm.DB) gorm.Migrator { return nil }
+
+func (dryRunDialector) DataTypeOf(*schema.Field) string { return "" }
+
+func (dryRunDialector) DefaultValueOf(*schema.Field) clause.Expression {
+	return clause.Expr{SQL: "DEFAULT"}
+}
+
+func (dryRunDialector) BindVarTo(writer clause.Writer, stmt *gorm.Statement, v interface{}) {
+	_ = writer.WriteByte('?')
+}
+
+func (dryRunDialector) QuoteTo(writer clause.Writer, str string) {
+	_, _ = writer.WriteString(`"` + strings.ReplaceAll(str, `"`, `""`) + `"`)
+}
+
+func (dryRunDialector) Explain(sql string, vars ...interface{}) string {
+	return logger.ExplainSQL(sql, nil, `'`, vars...)
+}
+
+type account struct {
+	ID        int
+	Name      string
+	Status    string
+	CreatedAt string
+}
+
+func TestFilterParams_Apply(t *testing.T) {
+	db, err := gorm.Open(dryRunDialector{}, &gorm.Config{DryRun: true})
+	assert.NoError(t, err)
+	accounts := FilterSchema{
+		Fields: map[string]FilterField{
+			"name":    {Column: "name", Operations: []Operation{Eq, Ct, StartsWith}, Sortable: true},
+			"status":  {Column: "status"},
+			"created": {Column: "created_at", Sortable: true},
+		},
+		DefaultSort: []Sort{{Key: "name", Value: "asc"}},
+	}
+
+	paginator := NewPaginator()
+	paginator.SetPage(3)
+	paginator.SetLimit(20)
+	params := FilterParams{
+		Filters: []Filter{
+			{Key: "name", Op: Ct, Value: []interface{}{"50%_off"}},
+			{Key: "status", Op: In, Value: []interface{}{"new", "paid"}, Group: "state"},
+			{Key: "status", Op: IsNull, Group: "state"},
+			{Key: "created", Op: Bt, Value: []interface{}{"2024-01-01", "2024-02-01"}},
+		},
+		Sorts:     []Sort{{Key: "created", Value: "desc"}},
+		paginator: paginator,
+	}
+	query, pager, e := params.Apply(db.Model(&account{}), accounts)
+	assert.Nil(t, e)
+	assert.Equal(t, paginator, pager)
+	stmt := query.Find(&[]account{}).Statement
+	assert.Equal(t, `SELECT * FROM "accounts" WHERE "name" LIKE ? ESCAPE '!' AND ("status" IN (?,?) OR "status" IS NULL) AND ("created_at" BETWEEN ? AND ?) ORDER BY "created_at" DESC LIMIT 20 OFFSET 40`, stmt.SQL.String())
+	assert.Equal(t, []interface{}{"%50!%!_off%", "new", "paid", "2024-01-01", "2024-02-01"}, stmt.Vars)
+
+	query, _, e = FilterParams{Page: 1, Limit: 5}.Apply(db.Model(&account{}), accounts)
+	assert.Nil(t, e)
+	stmt = query.Find(&[]account{}).Statement
+	assert.Equal(t, `SELECT * FROM "accounts" ORDER BY "name" LIMIT 5`, stmt.SQL.String())
+
+	fake := &fakeRows{total: 12, rows: [][]account{{{ID: 6}}}}
+	var page []account
+	pager, e = FilterParams{Page: 2, Limit: 5}.Find(fake.open(t).Model(&account{}), accounts, &page)
+	assert.Nil(t, e)
+	assert.Equal(t, 12, pager.Total())
+	assert.Equal(t, 2, pager.Page())
+	assert.Equal(t, `SELECT * FROM "accounts" ORDER BY "name" LIMIT 5 OFFSET 5`, fake.sql[0])
+
+	for _, p := range []FilterParams{
+		{Filters: []Filter{{Key: "password", Op: Eq, Value: []interface{}{"x"}}}},
+		{Filters: []Filter{{Key: "name", Op: Gt, Value: []interface{}{"x"}}}},
+		{Filters: []Filter{{Key: "name; DROP TABLE accounts", Op: Eq, Value: []interface{}{"x"}}}},
+		{Sorts: []Sort{{Key: "status", Value: "asc"}}},
+	} {
+		_, _, e = p.Apply(db.Model(&account{}), accounts)
+		if assert.NotNil(t, e) {
+			assert.Len(t, e.Errors(), 1)
+		}
+	}
+}
@@ -2,27 +2,35 @@ package gateway
 
 import (
 	"context"
+	"crypto/x509"
+	stderrors "errors"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	errors "github.com/haderianous/go-error"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
 	"io"
 	"net/http"
-	"net/url"
 	"strconv"
-	"strings"
+	"time"
 )
 
 type Request interface {
 	GetContext() context.Context
+	SetContext(ctx context.Context)
+	GinContext() *gin.Context
 	GetClientIp() string
 	GetMethod() string
 	GetFullPath() string
 	GetHeader(key string) string
+	GetClientCertificate() *x509.Certificate
 	Paginator() Paginator
 
 	SetLanguage(lang Language)
 	GetLanguage() Language
 
+	Route() RouteInfo
+	SetRoute(route RouteInfo)
+
 	GetStatusCode() int
 	SetStatusCode(statusCode int)
 	GetMessage() string
@@ -45,22 +53,32 @@ type Request interface {
 	GetKey(key string) (value any, exists bool)
 
 	RespondHtml(status int, contentType string, body any)
+	SendEvents(events <-chan Event, heartbeat time.Duration) error
+	StreamJSON(next func() (item any, ok bool, err error)) error
+	Download(name string, content io.Reader, modTime time.Time) error
+	DownloadFile(path string) error
 }
 
 type request struct {
 	context     *gin.Context
+	ctx         context.Context
 	statusCode  int
 	message     string
 	body        any
 	language    Language
+	route       RouteInfo
 	paginator   Paginator
 	filters     FilterParams
+	encoders    []Encoder
 	isResponded bool
 }
 
-func NewRequest(ctx *gin.Context, languageBundle *i18n.Bundle) Request {
+// NewRequest wraps ctx, encoders decode the request bodies whose
+// Content-Type they handle.
+func NewRequest(ctx *gin.Context, languageBundle *i18n.Bundle, encoders ...Encoder) Request {
 	req := &request{
-		context: ctx,
+		context:  ctx,
+		encoders: encoders,
 	}
 	if languageBundle != nil {
 		acceptLang := ctx.Request.Header.Get("Accept-Language")
@@ -71,9 +89,26 @@ func NewRequest(ctx *gin.Context, languageBundle *i18n.Bundle) Request {
 }
 
 func (r *request) GetContext() context.Context {
+	if r.ctx != nil {
+		return r.ctx
+	}
 	return r.context
 }
 
+func (r *request) SetContext(ctx context.Context) {
+	r.ctx = ctx
+}
+
+func (r *request) GinContext() *gin.Context {
+	return r.context
+}
+
+func (r *request) clone(c *gin.Context) *request {
+	cp := *r
+	cp.context = c
+	return &cp
+}
+
 func (r *request) GetClientIp() string {
 	return r.Request().RemoteAddr
 }
@@ -90,6 +125,16 @@ func (r *request) GetHeader(key string) string {
 	return r.Request().Header.Get(key)
 }
 
+// GetClientCertificate returns the verified certificate the client presented
+// over mutual TLS, or nil for plain or one-way TLS connections.
+func (r *request) GetClientCertificate() *x509.Certificate {
+	state := r.Request().TLS
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return state.VerifiedChains[0][0]
+}
+
 func (r *request) Paginator() Paginator {
 	if r.paginator != nil {
 		return r.paginator
@@ -115,6 +160,14 @@ func (r *request) GetLanguage() Language {
 	return r.language
 }
 
+func (r *request) Route() RouteInfo {
+	return r.route
+}
+
+func (r *request) SetRoute(route RouteInfo) {
+	r.route = route
+}
+
 func (r *request) GetStatusCode() int {
 	return r.statusCode
 }
@@ -164,9 +217,9 @@ func (r *request) BindRequest(req Validatable) (err errors.ErrorModel) {
 	if e != nil {
 		return errors.DefaultUnProcessable.WithError(e)
 	}
-	e = r.context.ShouldBind(req)
+	e = r.bindBody(req)
 	if e != nil && e != io.EOF {
-		return errors.DefaultUnProcessable.WithError(e)
+		return bindError(e)
 	}
 	e = r.context.ShouldBindHeader(req)
 	if e != nil && e != io.EOF {
@@ -183,6 +236,27 @@ func (r *request) BindRequest(req Validatable) (err errors.ErrorModel) {
 	return nil
 }
 
+// bindBody decodes the body with the encoder of its Content-Type, gin
+// bindings handle the rest, e.g. forms.
+func (r *request) bindBody(obj any) error {
+	encoder, ok := encoderFor(r.context.ContentType(), r.encoders)
+	if !ok || r.context.Request.Body == nil {
+		return r.context.ShouldBind(obj)
+	}
+	if err := encoder.Decode(r.context.Request.Body, obj); err != nil {
+		return err
+	}
+	return binding.Validator.ValidateStruct(obj)
+}
+
+func bindError(e error) errors.ErrorModel {
+	var maxBytesErr *http.MaxBytesError
+	if stderrors.As(e, &maxBytesErr) {
+		return DefaultEntityTooLargeError.WithError(e)
+	}
+	return errors.DefaultUnProcessable.WithError(e)
+}
+
 func (r *request) GetQuery(key string) string {
 	return r.context.Query(key)
 }
@@ -221,90 +295,39 @@ func (r *request) RespondHtml(status int, name string, body any) {
 }
 
 func (r *request) BindFilters() errors.ErrorModel {
-	qp, err := url.QueryUnescape(r.Request().URL.RawQuery)
-	if err != nil {
-		return errors.DefaultUnProcessable.WithError(err)
+	filters, sorts, paramErr := parseFilterParams(r.Request().URL.RawQuery)
+	if paramErr != nil {
+		return paramErr.errorModel(r.language)
 	}
-
-	separatedQpCollection := strings.Split(qp, "&")
-	sorts := make([]Sort, 0)
-	filters := make([]Filter, 0)
-	fpCollection, spCollection := make([]string, 0), make([]string, 0)
-
-	for _, separatedQp := range separatedQpCollection {
-		if strings.Contains(separatedQp, "filters[") {
-			fpCollection = append(fpCollection, separatedQp)
-		} else if strings.Contains(separatedQp, "sorts[") {
-			spCollection = append(spCollection, separatedQp)
+	var keyset *cursor
+	var token string
+	value, _ := r.Route().Metadata.Get(FilterSchemaKey)
+	// Handle refuses routes whose metadata holds anything else
+	if schema, ok := value.(FilterSchema); ok {
+		given := len(sorts) > 0
+		var errs []*paramError
+		if filters, sorts, errs = schema.bind(filters, sorts); errs != nil {
+			return fieldErrors(errs, r.language)
 		}
-	}
-
-	if len(spCollection) > 0 {
-		firstSpIndex := spCollection[0][0:8]
-		sorts = fillSortsByEntity(spCollection, firstSpIndex)
-	}
-
-	if len(fpCollection) > 0 {
-		firstFpIndex := fpCollection[0][0:10]
-		filters = fillFiltersByEntity(fpCollection, firstFpIndex)
-	}
-
-	r.filters = FilterParams{
-		Filters: filters,
-		Sorts:   sorts,
-		Page:    r.Paginator().Page(),
-		Limit:   r.Paginator().PerPage(),
-	}
-	return nil
-}
-
-func fillSortsByEntity(spCollection []string, sStr string) (sorts []Sort) {
-	var s Sort
-	for index := 0; index < len(spCollection); index++ {
-		if strings.Contains(spCollection[index], sStr) {
-			keyValues := strings.Split(spCollection[index], "=")
-			k := keyValues[0][9:10]
-
-			if k == "k" {
-				s.Key = keyValues[1]
-			} else if k == "v" {
-				s.Value = keyValues[1]
+		if schema.Cursors != nil && r.GetQuery("cursor") != "" {
+			token = r.GetQuery("cursor")
+			if keyset, paramErr = schema.bindCursor(token, sorts, given); paramErr != nil {
+				return paramErr.errorModel(r.language)
 			}
-			spCollection = append(spCollection[:index], spCollection[index+1:]...)
-			index = -1
-		}
-	}
-	sorts = append(sorts, s)
-	if len(spCollection) > 0 {
-		sort := fillSortsByEntity(spCollection, spCollection[0][0:8])
-		sorts = append(sorts, sort...)
-	}
-	return
-}
-
-func fillFiltersByEntity(fpCollection []string, sStr string) (filters []Filter) {
-	var v []interface{}
-	var f Filter
-	for index := 0; index < len(fpCollection); index++ {
-		if strings.Contains(fpCollection[index], sStr) {
-			keyValues := strings.Split(fpCollection[index], "=")
-			k := keyValues[0][11:12]
-			if k == "k" {
-				f.Key = keyValues[1]
-			} else if k == "v" {
-				v = append(v, keyValues[1])
-				f.Value = v
-			} else if k == "o" {
-				f.Op = Operation(keyValues[1])
+			if len(keyset.Sorts) > 0 {
+				sorts = keyset.Sorts
 			}
-			fpCollection = append(fpCollection[:index], fpCollection[index+1:]...)
-			index = -1
 		}
 	}
-	filters = append(filters, f)
-	if len(fpCollection) > 0 {
-		fil := fillFiltersByEntity(fpCollection, fpCollection[0][0:10])
-		filters = append(filters, fil...)
+	r.filters = FilterParams{
+		Filters:   filters,
+		Sorts:     sorts,
+		Page:      r.Paginator().Page(),
+		Limit:     r.Paginator().PerPage(),
+		Cursor:    token,
+		paginator: r.Paginator(),
+		language:  r.language,
+		cursor:    keyset,
 	}
-	return
+	return nil
 }
@@ -1,21 +1,46 @@
 package gateway
 
 import (
-	"github.com/gin-gonic/gin"
+	"bytes"
 	"github.com/haderianous/go-error"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
-	"reflect"
-	"time"
+	"net/http"
+	"sync"
 )
 
 type Responder interface {
 	Respond(Request, any)
 	RespondError(Request, errors.ErrorModel)
 	LanguageBundle() *i18n.Bundle
+	RegisterEncoder(Encoder)
+	Encoders() []Encoder
+	// Envelope is the envelope of the routes whose group picked none.
+	Envelope() Envelope
 }
 
 type responder struct {
 	languageBundle *i18n.Bundle
+	envelope       Envelope
+	statusPolicy   StatusPolicy
+	mu             sync.RWMutex
+	encoders       []Encoder
+}
+
+type ResponderOption func(r *responder)
+
+// WithEnvelope replaces the default Response envelope, route groups may still
+// pick their own through RouterGroup.WithEnvelope.
+func WithEnvelope(envelope Envelope) ResponderOption {
+	return func(r *responder) {
+		r.envelope = envelope
+	}
+}
+
+// WithEncoder registers encoder, see Responder.RegisterEncoder.
+func WithEncoder(encoder Encoder) ResponderOption {
+	return func(r *responder) {
+		r.RegisterEncoder(encoder)
+	}
 }
 
 type Response struct {
@@ -24,88 +49,146 @@ type Response struct {
 	Version       string `json:"version"`
 	RepresentedAt string `json:"represented_at"`
 	Data          struct {
-		Total   int `json:"total"`
-		PerPage int `json:"per_page"`
-		Result  any `json:"result"`
+		Total      int    `json:"total"`
+		PerPage    int    `json:"per_page"`
+		NextCursor string `json:"next_cursor,omitempty"`
+		PrevCursor string `json:"prev_cursor,omitempty"`
+		Result     any    `json:"result"`
+	} `json:"data"`
+}
+
+// ObjectResponse is the Response of single object results, see ShapeObject.
+type ObjectResponse struct {
+	Message       string `json:"message"`
+	Error         string `json:"error,omitempty"`
+	Version       string `json:"version"`
+	RepresentedAt string `json:"represented_at"`
+	Data          struct {
+		Result any `json:"result"`
 	} `json:"data"`
 }
 
-func NewResponder(languageBundle *i18n.Bundle) Responder {
-	return &responder{languageBundle: languageBundle}
+// NewResponder answers with JSON, the other formats are opt in through
+// WithEncoder or RegisterEncoder.
+func NewResponder(languageBundle *i18n.Bundle, opts ...ResponderOption) Responder {
+	r := &responder{
+		languageBundle: languageBundle,
+		envelope:       DefaultEnvelope(),
+		encoders:       []Encoder{JSONEncoder()},
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
 }
 
 func (r *responder) LanguageBundle() *i18n.Bundle {
 	return r.languageBundle
 }
 
+// RegisterEncoder adds encoder to the formats responses are negotiated
+// between and request bodies are decoded from. It replaces the encoder of the
+// same primary media type, encoders registered first are preferred on ties.
+func (r *responder) RegisterEncoder(encoder Encoder) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, e := range r.encoders {
+		if e.MediaTypes()[0] == encoder.MediaTypes()[0] {
+			r.encoders[i] = encoder
+			return
+		}
+	}
+	r.encoders = append(r.encoders, encoder)
+}
+
+func (r *responder) Encoders() []Encoder {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	encoders := make([]Encoder, len(r.encoders))
+	copy(encoders, r.encoders)
+	return encoders
+}
+
+func (r *responder) Envelope() Envelope {
+	return r.envelope
+}
+
 func (r *responder) Respond(req Request, result any) {
 	req.SetIsResponded(true)
-	response := Response{
-		Message:       req.GetMessage(),
-		Version:       "v1",
-		RepresentedAt: time.Now().Format("2006-01-02 15:04:05"),
-		Data: struct {
-			Total   int `json:"total"`
-			PerPage int `json:"per_page"`
-			Result  any `json:"result"`
-		}{
-			Total:   req.Paginator().Total(),
-			PerPage: req.Paginator().PerPage(),
-			Result:  result,
-		},
+	if r.statusPolicy != nil {
+		status, message := r.statusPolicy(req, result)
+		if req.GetStatusCode() == 0 {
+			req.SetStatusCode(status)
+		}
+		if req.GetMessage() == "" {
+			req.SetMessage(message)
+		}
 	}
 
-	if result == nil {
-		response.Data.Result = []any{}
-	} else if reflect.TypeOf(result).Kind() == reflect.Slice {
-		response.Data.Result = result
-	} else {
-		response.Data.Result = []any{result}
+	body, contentType := r.envelopeOf(req).Success(req, withProtoJSON(result))
+	encoder, body, ok := negotiate(req.GetHeader("Accept"), r.Encoders(), body, result)
+	if !ok {
+		r.RespondError(req, DefaultNotAcceptableError)
+		return
 	}
-
-	//if req.GetMethod() == http.MethodPut || req.GetMethod() == http.MethodPost {
-	//	response.Data.Result = []any{result}
-	//}
-
-	//var status int
-	//switch req.GetMethod() {
-	//case http.MethodPost, http.MethodPut:
-	//	if result == nil {
-	//		status = http.StatusNoContent
-	//		break
-	//	}
-	//	response.Message = req.GetLanguage().Localize("CreatedMessage", "Item has been created successfully")
-	//	if req.GetMethod() == http.MethodPut {
-	//		response.Message = req.GetLanguage().Localize("UpdatedMessage", "Item has been updated successfully")
-	//	}
-	//	response.Data.Result = []any{result}
-	//	status = http.StatusCreated
-	//case http.MethodGet:
-	//	status = http.StatusOK
-	//	if result == nil || reflect.ValueOf(result).IsNil() {
-	//		status = http.StatusNoContent
-	//		break
-	//	}
-	//case http.MethodDelete:
-	//	if result == nil {
-	//		status = http.StatusNoContent
-	//		break
-	//	}
-	//	status = http.StatusOK
-	//}
-
-	req.GetContext().(*gin.Context).JSON(req.GetStatusCode(), response)
+	status := req.GetStatusCode()
+	if status == 0 {
+		status = http.StatusOK
+	}
+	r.write(req, encoder, status, body, contentType)
 	return
 }
 
 func (r *responder) RespondError(req Request, err errors.ErrorModel) {
-	ctx := req.GetContext().(*gin.Context)
+	ctx := req.GinContext()
 	_ = ctx.Error(err)
-	if err.ErrorId() != "" && (err.IsMsgDefault() || !err.IsIdDefault()) {
+	if ctx.Writer.Written() {
+		// a stream or download already started, the error can only be logged
+		ctx.Abort()
+		return
+	}
+	if req.GetLanguage() != nil && err.ErrorId() != "" && (err.IsMsgDefault() || !err.IsIdDefault()) {
 		err = err.WithMessage(req.GetLanguage().Localize(err.MessageId(), err.Message()))
 		err = err.WithErrorText(req.GetLanguage().Localize(err.ErrorId(), err.ErrorText()))
 	}
-	ctx.JSON(getStatusCodeByError(err.Type()), err)
+	status := getStatusCodeByError(err.Type())
+	body, contentType := r.envelopeOf(req).Failure(req, status, err)
+	encoders := r.Encoders()
+	encoder, body, ok := negotiate(req.GetHeader("Accept"), encoders, body, nil)
+	if !ok {
+		// errors are still worth reporting in a format the client did not ask for
+		encoder = encoders[0]
+	}
+	r.write(req, encoder, status, body, contentType)
 	ctx.Abort()
 	return
 }
+
+func (r *responder) envelopeOf(req Request) Envelope {
+	return req.Route().envelopeOr(r.envelope)
+}
+
+// write renders body with encoder, HEAD requests and bodiless statuses only
+// get the status line and headers.
+func (r *responder) write(req Request, encoder Encoder, status int, body any, envelopeType string) {
+	ctx := req.GinContext()
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		ctx.Status(status)
+		ctx.Writer.WriteHeaderNow()
+		return
+	}
+	var buf bytes.Buffer
+	if err := encoder.Encode(&buf, body); err != nil {
+		_ = ctx.Error(err)
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	ctx.Header("Content-Type", contentType(encoder, envelopeType))
+	ctx.Writer.Header().Add("Vary", "Accept")
+	ctx.Status(status)
+	if req.GetMethod() == http.MethodHead {
+		ctx.Writer.WriteHeaderNow()
+		return
+	}
+	_, _ = ctx.Writer.Write(buf.Bytes())
+}
@@ -1,48 +1,260 @@
 package gateway
 
 import (
+	"context"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"net/url"
+	pathpkg "path"
+	"strings"
+	"time"
 )
 
+var anyMethods = []string{
+	http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodHead, http.MethodOptions, http.MethodDelete, http.MethodConnect,
+	http.MethodTrace,
+}
+
 type routerGroup struct {
-	server     *gin.Engine
-	group      *gin.RouterGroup
-	controller Controller
+	server      *gin.Engine
+	group       *gin.RouterGroup
+	controller  Controller
+	maxBodySize int64
+	timeout     time.Duration
+	routes      *routeTable
+	middlewares *[]Handler
+	metadata    Metadata
+	versions    *versionSet
+	version     string
+	envelope    Envelope
+	sockets     *socketSet
+	addBalancer func(Balancer)
 }
 
-func newRouterGroup(path string, s *gin.Engine, c Controller) RouterGroup {
-	return &routerGroup{server: s, controller: c, group: s.Group(path)}
+func newRouterGroup(path string, s *server) RouterGroup {
+	rg := &routerGroup{
+		server:      s.engine,
+		controller:  s.controller,
+		group:       s.engine.Group(path),
+		maxBodySize: s.options.MaxBodySize,
+		routes:      s.routes,
+		middlewares: &[]Handler{},
+		versions:    s.versions,
+		sockets:     s.sockets,
+		addBalancer: s.AddBalancer,
+	}
+	// limits apply before any group middleware reads the body
+	rg.group.Use(rg.getHandler(&routeBodyLimitHandler{}, false))
+	return rg
 }
 
 func (rg routerGroup) Group(path string) RouterGroup {
 	rg.group = rg.group.Group(path)
+	middlewares := append([]Handler{}, *rg.middlewares...)
+	rg.middlewares = &middlewares
 	return rg
 }
 
+// WithTimeout returns a copy of the group whose routes and middlewares share
+// a deadline of timeout per request.
+func (rg routerGroup) WithTimeout(timeout time.Duration) RouterGroup {
+	rg.timeout = timeout
+	return rg
+}
+
+// WithMetadata returns a copy of the group whose routes carry key in their
+// metadata, route level Meta handlers take precedence.
+func (rg routerGroup) WithMetadata(key string, value any) RouterGroup {
+	rg.metadata = rg.metadata.with(Metadata{key: value})
+	return rg
+}
+
+// WithEnvelope returns a copy of the group whose routes are answered through
+// envelope instead of the one of the Responder.
+func (rg routerGroup) WithEnvelope(envelope Envelope) RouterGroup {
+	rg.envelope = envelope
+	return rg
+}
+
+// Version returns a child group serving version under path prefix version,
+// e.g. /api/v2. Requests without the prefix reach it through the
+// Accept-Version header, a version media type parameter or by being the
+// default version of the parent group.
+func (rg routerGroup) Version(version string, opts ...VersionOption) RouterGroup {
+	v := &apiVersion{name: version, base: rg.group.BasePath()}
+	for _, opt := range opts {
+		opt(v)
+	}
+	rg.versions.add(v)
+	child := rg.Group(version).(routerGroup)
+	child.version = version
+	if !v.deprecated.IsZero() || !v.sunset.IsZero() {
+		child.Middleware(&deprecationHandler{version: v})
+	}
+	return child
+}
+
 func (rg routerGroup) Get(path string, handlers ...Handler) {
-	rg.group.GET(path, rg.matchRoute(handlers...)...)
+	rg.Handle(http.MethodGet, path, handlers...)
 }
 
 func (rg routerGroup) Post(path string, handlers ...Handler) {
-	rg.group.POST(path, rg.matchRoute(handlers...)...)
+	rg.Handle(http.MethodPost, path, handlers...)
 }
 
 func (rg routerGroup) Put(path string, handlers ...Handler) {
-	rg.group.PUT(path, rg.matchRoute(handlers...)...)
+	rg.Handle(http.MethodPut, path, handlers...)
 }
 
 func (rg routerGroup) Delete(path string, handlers ...Handler) {
-	rg.group.DELETE(path, rg.matchRoute(handlers...)...)
+	rg.Handle(http.MethodDelete, path, handlers...)
+}
+
+// Proxy forwards path and everything under it to upstream. The route takes
+// every path below path, so it cannot share it with other routes of the
+// group, Proxy("users", ...) next to Get("users/:id", ...) panics.
+func (rg routerGroup) Proxy(path string, upstream *url.URL, handlers ...Handler) {
+	prefix := pathpkg.Join(rg.group.BasePath(), path)
+	rg.proxy(path, NewProxyHandler(upstream, WithStripPrefix(prefix)), handlers...)
+}
+
+// BalancedProxy proxies to the instances of balancer, whose health checks
+// run while the server serves.
+func (rg routerGroup) BalancedProxy(path string, balancer Balancer, handlers ...Handler) {
+	if rg.addBalancer != nil {
+		rg.addBalancer(balancer)
+	}
+	prefix := pathpkg.Join(rg.group.BasePath(), path)
+	rg.proxy(path, NewBalancedProxyHandler(balancer, WithStripPrefix(prefix)), handlers...)
+}
+
+func (rg routerGroup) proxy(path string, proxy Handler, handlers ...Handler) {
+	rg.catchAll(path, "proxyPath", append(handlers, proxy)...)
+}
+
+// Mount serves path and everything under it with handler, it cannot share
+// them with other routes of the group either.
+func (rg routerGroup) Mount(path string, handler http.Handler, handlers ...Handler) {
+	prefix := joinPaths(rg.group.BasePath(), strings.TrimRight(path, "/"))
+	rg.catchAll(path, "mountPath", append(handlers, HTTPHandler(handler, prefix))...)
+}
+
+// catchAll registers path itself and a wildcard named param under it. The
+// trailing slash is dropped since gin cannot hold both /path/ and
+// /path/*param, and a root path only gets the wildcard when the group is the
+// root too.
+func (rg routerGroup) catchAll(path, param string, handlers ...Handler) {
+	path = strings.TrimRight(path, "/")
+	wildcard := pathpkg.Join("/", path, "*"+param)
+	defer func() {
+		if err := recover(); err != nil {
+			if msg, ok := err.(string); !ok || !strings.Contains(msg, "conflict") {
+				panic(err)
+			}
+			panic(fmt.Sprintf("gateway: %s takes every path under it and conflicts with another route of the group: %v", joinPaths(rg.group.BasePath(), wildcard), err))
+		}
+	}()
+	if path != "" || rg.group.BasePath() != "/" {
+		rg.Any(path, handlers...)
+	}
+	rg.Any(wildcard, handlers...)
+}
+
+func (rg routerGroup) UseHTTP(middlewares ...func(http.Handler) http.Handler) {
+	for _, mw := range middlewares {
+		rg.Middleware(HTTPMiddleware(mw))
+	}
+}
+
+func (rg routerGroup) Patch(path string, handlers ...Handler) {
+	rg.Handle(http.MethodPatch, path, handlers...)
+}
+
+func (rg routerGroup) Head(path string, handlers ...Handler) {
+	rg.Handle(http.MethodHead, path, handlers...)
+}
+
+func (rg routerGroup) Options(path string, handlers ...Handler) {
+	rg.Handle(http.MethodOptions, path, handlers...)
+}
+
+func (rg routerGroup) Any(path string, handlers ...Handler) {
+	for _, method := range anyMethods {
+		rg.Handle(method, path, handlers...)
+	}
+}
+
+func (rg routerGroup) Handle(method, path string, handlers ...Handler) {
+	handlers, metadata := splitMetadata(handlers)
+	handlers, bodyLimit := rg.bodyLimit(handlers)
+	metadata = rg.metadata.with(metadata)
+	if value, ok := metadata.Get(FilterSchemaKey); ok {
+		schema, ok := value.(FilterSchema)
+		if !ok {
+			panic(fmt.Sprintf("gateway: the %s metadata of route %s %s is a %T, set it with Filterable", FilterSchemaKey, method, path, value))
+		}
+		if err := schema.validate(); err != nil {
+			panic(fmt.Sprintf("%s, route %s %s", err, method, path))
+		}
+	}
+	rg.group.Handle(method, path, rg.matchRoute(handlers...)...)
+	rg.routes.add(RouteInfo{
+		Method:    method,
+		Path:      joinPaths(rg.group.BasePath(), path),
+		Metadata:  metadata,
+		Version:   rg.version,
+		envelope:  rg.envelope,
+		bodyLimit: bodyLimit,
+		timeout:   rg.timeout,
+	}, *rg.middlewares, handlers)
+}
+
+// WebSocket registers a GET route whose last handler, built with
+// NewWebSocketHandler, serves the upgraded connection once the middlewares
+// and the other handlers ran. Its connections are closed on Server.Shutdown.
+func (rg routerGroup) WebSocket(path string, handlers ...Handler) {
+	if len(handlers) == 0 {
+		panic("gateway: WebSocket route " + path + " has no handler")
+	}
+	ws, ok := handlers[len(handlers)-1].(*webSocketHandler)
+	if !ok {
+		panic("gateway: the last handler of WebSocket route " + path + " must come from NewWebSocketHandler")
+	}
+	cp := *ws
+	cp.sockets = rg.sockets
+	handlers = append(append([]Handler{}, handlers[:len(handlers)-1]...), &cp)
+	// the deadline and timeout writer of timeouts cannot outlive an upgrade
+	rg.timeout = 0
+	rg.Handle(http.MethodGet, path, handlers...)
 }
 
 func (rg routerGroup) ServeHttp(w http.ResponseWriter, req *http.Request) {
+	rg.versions.rewrite(req, rg.routes)
 	rg.server.ServeHTTP(w, req)
 }
 
 func (rg routerGroup) Middleware(handlers ...Handler) {
-	hfs := rg.matchRoute(handlers...)
+	// group middlewares never respond, the route they precede does
+	var hfs []gin.HandlerFunc
+	for _, handler := range handlers {
+		hfs = append(hfs, rg.getHandler(handler, false))
+	}
 	rg.group.Use(hfs...)
+	*rg.middlewares = append(*rg.middlewares, handlers...)
+}
+
+// bodyLimit takes the NewBodyLimitHandler of a route out of its chain and
+// returns its limit, or the server wide one. The limit is applied by the
+// first handler of the group chain, see routeBodyLimitHandler.
+func (rg routerGroup) bodyLimit(handlers []Handler) ([]Handler, int64) {
+	for i, handler := range handlers {
+		if h, ok := handler.(*bodyLimitHandler); ok {
+			return append(append([]Handler{}, handlers[:i]...), handlers[i+1:]...), h.limit
+		}
+	}
+	return handlers, rg.maxBodySize
 }
 
 func (rg routerGroup) matchRoute(handlers ...Handler) []gin.HandlerFunc {
@@ -59,11 +271,23 @@ func (rg routerGroup) getHandler(handler Handler, shouldRespond bool) gin.Handle
 		if _req, ok := c.Get("req"); ok {
 			req = _req.(Request)
 		} else {
-			req = NewRequest(c, rg.controller.LanguageBundle())
+			req = NewRequest(c, rg.controller.LanguageBundle(), rg.controller.Encoders()...)
+			if route, ok := rg.routes.find(c.Request.Method, c.FullPath()); ok {
+				req.SetRoute(route)
+			}
 			c.Set("req", req)
 		}
 		req.SetIsResponded(false)
-		if rg.controller.Process(handler, req, shouldRespond) {
+		if rg.timeout > 0 {
+			stop := rg.withTimeout(req)
+			defer stop()
+		}
+		next := rg.controller.Process(handler, req, shouldRespond)
+		if rg.timeout > 0 && req.GetContext().Err() == context.DeadlineExceeded {
+			c.Abort()
+			return
+		}
+		if next {
 			c.Next()
 		}
 	}
@@ -1,13 +1,31 @@
 package gateway
 
-import "net/http"
+import (
+	"net/http"
+	"net/url"
+	"time"
+)
 
 type RouterGroup interface {
 	Group(path string) RouterGroup
+	Version(version string, opts ...VersionOption) RouterGroup
+	WithTimeout(timeout time.Duration) RouterGroup
+	WithMetadata(key string, value any) RouterGroup
+	WithEnvelope(envelope Envelope) RouterGroup
 	Get(path string, handlers ...Handler)
 	Post(path string, handlers ...Handler)
 	Put(path string, handlers ...Handler)
 	Delete(path string, handlers ...Handler)
+	Patch(path string, handlers ...Handler)
+	Head(path string, handlers ...Handler)
+	Options(path string, handlers ...Handler)
+	Any(path string, handlers ...Handler)
+	Handle(method, path string, handlers ...Handler)
 	ServeHttp(w http.ResponseWriter, req *http.Request)
 	Middleware(handlers ...Handler)
+	UseHTTP(middlewares ...func(http.Handler) http.Handler)
+	WebSocket(path string, handlers ...Handler)
+	Mount(path string, handler http.Handler, handlers ...Handler)
+	Proxy(path string, upstream *url.URL, handlers ...Handler)
+	BalancedProxy(path string, balancer Balancer, handlers ...Handler)
 }
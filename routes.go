@@ -0,0 +1,231 @@
+package gateway
+
+import (
+	"fmt"
+	errors "github.com/haderianous/go-error"
+	pathpkg "path"
+	"strings"
+	"sync"
+	"time"
+)
+
+type RouteInfo struct {
+	Method      string   `json:"method"`
+	Path        string   `json:"path"`
+	Handler     string   `json:"handler"`
+	Middlewares []string `json:"middlewares"`
+	Metadata    Metadata `json:"metadata,omitempty"`
+	Version     string   `json:"version,omitempty"`
+	doc         *RouteDoc
+	envelope    Envelope
+	bodyLimit   int64
+	timeout     time.Duration
+}
+
+// envelopeOr returns the envelope of the route's group, or fallback when it
+// picked none.
+func (r RouteInfo) envelopeOr(fallback Envelope) Envelope {
+	if r.envelope != nil {
+		return r.envelope
+	}
+	return fallback
+}
+
+// Metadata carries arbitrary route facts (permissions, rate-limit class,
+// deprecation date...) for route-aware middlewares to read from
+// Request.Route().
+type Metadata map[string]any
+
+func (m Metadata) Get(key string) (any, bool) {
+	value, ok := m[key]
+	return value, ok
+}
+
+// with returns a copy of m extended by other, m is never modified since
+// groups share it.
+func (m Metadata) with(other Metadata) Metadata {
+	if len(other) == 0 {
+		return m
+	}
+	merged := make(Metadata, len(m)+len(other))
+	for k, v := range m {
+		merged[k] = v
+	}
+	for k, v := range other {
+		merged[k] = v
+	}
+	return merged
+}
+
+type metadataHandler struct {
+	metadata Metadata
+}
+
+// Meta attaches metadata to the route it is registered on. It is taken out
+// of the chain on registration and never runs.
+func Meta(key string, value any) Handler {
+	return &metadataHandler{metadata: Metadata{key: value}}
+}
+
+func (h *metadataHandler) Handle(req Request) (any, errors.ErrorModel) {
+	return nil, nil
+}
+
+// splitMetadata separates Meta handlers from the ones that actually run.
+func splitMetadata(handlers []Handler) ([]Handler, Metadata) {
+	var metadata Metadata
+	chain := make([]Handler, 0, len(handlers))
+	for _, h := range handlers {
+		if m, ok := h.(*metadataHandler); ok {
+			metadata = metadata.with(m.metadata)
+			continue
+		}
+		chain = append(chain, h)
+	}
+	return chain, metadata
+}
+
+type routeTable struct {
+	mu     sync.RWMutex
+	routes []RouteInfo
+	index  map[string]int
+}
+
+// add records a route described by info, middlewares are the group ones
+// followed by every route handler but the last.
+func (t *routeTable) add(info RouteInfo, middlewares []Handler, handlers []Handler) {
+	if t == nil || len(handlers) == 0 {
+		return
+	}
+	last := handlers[len(handlers)-1]
+	info.Handler = handlerName(last)
+	info.Middlewares = make([]string, 0, len(middlewares)+len(handlers)-1)
+	info.doc = routeDoc(last)
+	for _, m := range middlewares {
+		info.Middlewares = append(info.Middlewares, handlerName(m))
+	}
+	for _, h := range handlers[:len(handlers)-1] {
+		info.Middlewares = append(info.Middlewares, handlerName(h))
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.index == nil {
+		t.index = map[string]int{}
+	}
+	t.index[info.Method+" "+info.Path] = len(t.routes)
+	t.routes = append(t.routes, info)
+}
+
+// match reports whether any route, whatever its method, serves path.
+func (t *routeTable) match(path string) bool {
+	if t == nil {
+		return false
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, route := range t.routes {
+		if matchPath(route.Path, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *routeTable) find(method, path string) (RouteInfo, bool) {
+	if t == nil {
+		return RouteInfo{}, false
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	i, ok := t.index[method+" "+path]
+	if !ok {
+		return RouteInfo{}, false
+	}
+	return t.routes[i], true
+}
+
+func (t *routeTable) list() []RouteInfo {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	routes := make([]RouteInfo, len(t.routes))
+	copy(routes, t.routes)
+	return routes
+}
+
+// typedRoute is implemented by handlers that know their input and output
+// types, see Typed.
+type typedRoute interface {
+	routeTypes() (in Validatable, out any)
+}
+
+// routeDoc returns the documentation of a route handler, filling the request
+// and response types from typed handlers when Document did not set them.
+func routeDoc(h Handler) *RouteDoc {
+	var doc *RouteDoc
+	if d, ok := h.(*documentedHandler); ok {
+		cp := d.doc
+		doc = &cp
+		h = d.Handler
+	}
+	if p, ok := h.(*proxyHandler); ok {
+		if doc == nil {
+			doc = &RouteDoc{}
+		}
+		doc.Errors = append(doc.Errors[:len(doc.Errors):len(doc.Errors)], DefaultBadGatewayError, DefaultGatewayTimeoutError)
+		if p.balancer != nil {
+			doc.Errors = append(doc.Errors, errors.DefaultServiceUnAvaialable)
+		}
+		return doc
+	}
+	typed, ok := h.(typedRoute)
+	if !ok {
+		return doc
+	}
+	if doc == nil {
+		doc = &RouteDoc{}
+	}
+	in, out := typed.routeTypes()
+	if doc.Request == nil {
+		doc.Request = in
+	}
+	if doc.Response == nil {
+		doc.Response = out
+	}
+	return doc
+}
+
+func handlerName(h Handler) string {
+	if d, ok := h.(*documentedHandler); ok {
+		h = d.Handler
+	}
+	return fmt.Sprintf("%T", h)
+}
+
+func joinPaths(base, path string) string {
+	if path == "" {
+		return base
+	}
+	joined := pathpkg.Join(base, path)
+	if strings.HasSuffix(path, "/") && !strings.HasSuffix(joined, "/") {
+		joined += "/"
+	}
+	return joined
+}
+
+type routeTableHandler struct {
+	server Server
+}
+
+// NewRouteTableHandler lists the routes registered on server, mount it on a
+// protected group to expose the route table for audits.
+func NewRouteTableHandler(server Server) Handler {
+	return &routeTableHandler{server: server}
+}
+
+func (h *routeTableHandler) Handle(req Request) (any, errors.ErrorModel) {
+	routes := h.server.Routes()
+	req.Paginator().SetTotal(len(routes))
+	req.Paginator().SetLimit(len(routes))
+	return routes, nil
+}
@@ -2,6 +2,8 @@ package gateway
 
 import (
 	"context"
+	stderrors "errors"
+	"fmt"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/cookie"
@@ -9,44 +11,187 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/haderianous/go-logger/logger"
 	"gorm.io/gorm"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
+var errNoListeners = stderrors.New("gateway: no listener to serve on")
+
 type Server interface {
 	NewRouterGroup(path string) RouterGroup
+	Routes() []RouteInfo
 	Shutdown(timeout time.Duration) error
+	OnShutdown(hook ShutdownHook)
 	LoadHTMLGlob(pattern string)
 	NewSession(sessionName string, secretKey string)
 	HandleCorsMiddleware(allowedOrigins []string)
 	NewGormSession(db *gorm.DB, sessionName string, domain string, expired int, secretKey string)
+	AddBalancer(balancer Balancer)
 	Run(...string) error
+	Serve(listeners ...net.Listener) error
+	RunTLS(options TLSOptions, host ...string) error
+	RunWithSignals(timeout time.Duration, host ...string) error
+}
+
+// ShutdownHook releases a resource (db pool, session store, worker...) once
+// the server has stopped accepting requests and in-flight handlers drained.
+type ShutdownHook func(ctx context.Context) error
+
+type shutdownError []error
+
+func (e shutdownError) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e shutdownError) Unwrap() []error {
+	return e
+}
+
+func combineErrors(errs ...error) error {
+	var result shutdownError
+	for _, err := range errs {
+		if err != nil {
+			result = append(result, err)
+		}
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+// ServerOptions configures the underlying http.Server. Zero values keep the
+// net/http defaults, MaxBodySize of zero means no body limit.
+type ServerOptions struct {
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	MaxBodySize       int64
 }
 
 type server struct {
+	mu         sync.Mutex
+	options    ServerOptions
 	engine     *gin.Engine
-	httpServer http.Server // gin engine is inside this server
+	httpServer *http.Server // gin engine is inside this server
+	shutdown   bool
 	group      *gin.RouterGroup
 	logger     logger.Logger
 	controller Controller
+	balancers  []Balancer
+	hooks      []ShutdownHook
+	routes     *routeTable
+	versions   *versionSet
+	sockets    *socketSet
 }
 
-func NewServer(c Controller) Server {
-	return &server{
+func NewServer(c Controller, options ...ServerOptions) Server {
+	s := &server{
 		engine:     gin.New(),
 		logger:     logger.NewLogger(logger.InfoLevel, logger.JsonEncoding),
 		controller: c,
+		routes:     &routeTable{},
+		versions:   &versionSet{},
+		sockets:    &socketSet{},
+	}
+	if len(options) > 0 {
+		s.options = options[0]
 	}
+	s.engine.HandleMethodNotAllowed = true
+	rg := routerGroup{server: s.engine, controller: c}
+	s.engine.NoMethod(rg.getHandler(newMethodNotAllowedHandler(s.engine), true))
+	return s
 }
 
 func (s *server) NewRouterGroup(path string) RouterGroup {
-	return newRouterGroup(path, s.engine, s.controller)
+	return newRouterGroup(path, s)
 }
 
+// Shutdown stops accepting connections, waits for in-flight handlers until
+// the timeout, then stops balancers and runs the shutdown hooks in reverse
+// registration order. Every error met on the way is returned combined.
 func (s *server) Shutdown(timeout time.Duration) error {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
-	return s.httpServer.Shutdown(ctx)
+
+	s.mu.Lock()
+	s.shutdown = true
+	httpServer := s.httpServer
+	hooks := s.hooks
+	s.hooks = nil
+	s.mu.Unlock()
+
+	var errs []error
+	if httpServer != nil {
+		errs = append(errs, httpServer.Shutdown(ctx))
+	}
+	// hijacked connections are not tracked by http.Server
+	s.sockets.closeAll()
+	s.stopBalancers()
+	for i := len(hooks) - 1; i >= 0; i-- {
+		errs = append(errs, hooks[i](ctx))
+	}
+	return combineErrors(errs...)
+}
+
+// responder answers the routes of the server, OpenAPI documents their bodies
+// after it.
+func (s *server) responder() Responder {
+	return s.controller
+}
+
+// Routes lists every route registered on the server's groups.
+func (s *server) Routes() []RouteInfo {
+	return s.routes.list()
+}
+
+func (s *server) OnShutdown(hook ShutdownHook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = append(s.hooks, hook)
+}
+
+// AddBalancer has the health checks of balancer run while the server
+// serves, balancers of BalancedProxy routes are added on their own.
+func (s *server) AddBalancer(balancer Balancer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range s.balancers {
+		if b == balancer {
+			return
+		}
+	}
+	s.balancers = append(s.balancers, balancer)
+}
+
+func (s *server) startBalancers() {
+	s.mu.Lock()
+	balancers := append([]Balancer{}, s.balancers...)
+	s.mu.Unlock()
+	for _, b := range balancers {
+		b.Start()
+	}
+}
+
+func (s *server) stopBalancers() {
+	s.mu.Lock()
+	balancers := append([]Balancer{}, s.balancers...)
+	s.mu.Unlock()
+	for _, b := range balancers {
+		b.Stop()
+	}
 }
 
 func (s *server) NewSession(sessionName string, secretKey string) {
@@ -80,17 +225,138 @@ func (s *server) LoadHTMLGlob(pattern string) {
 	s.engine.LoadHTMLGlob(pattern)
 }
 
+// Run serves HTTP on every given address. Addresses of the form
+// unix:/path/to.sock listen on a unix socket; with no address the server
+// listens on $PORT, or :8080 when it is not set.
 func (s *server) Run(host ...string) error {
-	s.httpServer = http.Server{
-		Addr:    host[0],
-		Handler: s.engine,
+	listeners, err := listenAll(host)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listeners...)
+}
+
+// Serve serves HTTP on already open listeners, e.g. the ones handed over by
+// systemd socket activation.
+func (s *server) Serve(listeners ...net.Listener) error {
+	return s.serve(s.newHTTPServer(), listeners, false)
+}
+
+// RunTLS serves HTTPS (and HTTP/2 through ALPN) on every given address using
+// the certificate described by options.
+func (s *server) RunTLS(options TLSOptions, host ...string) error {
+	config, err := options.build()
+	if err != nil {
+		return err
+	}
+	listeners, err := listenAll(host)
+	if err != nil {
+		return err
 	}
-	if gin.IsDebugging() {
-		s.logger.InfoF("Listening and serving HTTP on %s", host[0])
+	httpServer := s.newHTTPServer()
+	httpServer.TLSConfig = config
+	return s.serve(httpServer, listeners, true)
+}
+
+// handler resolves header selected API versions before gin routes the
+// request.
+func (s *server) handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.versions.rewrite(r, s.routes)
+		s.engine.ServeHTTP(w, r)
+	})
+}
+
+func (s *server) newHTTPServer() *http.Server {
+	return &http.Server{
+		Handler:           s.handler(),
+		ReadTimeout:       s.options.ReadTimeout,
+		ReadHeaderTimeout: s.options.ReadHeaderTimeout,
+		WriteTimeout:      s.options.WriteTimeout,
+		IdleTimeout:       s.options.IdleTimeout,
+		MaxHeaderBytes:    s.options.MaxHeaderBytes,
 	}
-	err := s.httpServer.ListenAndServe()
-	if err == http.ErrServerClosed {
+}
+
+// serve runs httpServer on all listeners and returns once every one of them
+// stopped. A listener failing for any reason other than Shutdown closes the
+// others too. Once Shutdown was called it closes the listeners and returns
+// right away.
+func (s *server) serve(httpServer *http.Server, listeners []net.Listener, useTLS bool) error {
+	if len(listeners) == 0 {
+		return errNoListeners
+	}
+	s.mu.Lock()
+	if s.shutdown {
+		s.mu.Unlock()
+		for _, l := range listeners {
+			_ = l.Close()
+		}
 		return nil
 	}
+	s.httpServer = httpServer
+	s.mu.Unlock()
+	s.startBalancers()
+
+	scheme := "HTTP"
+	if useTLS {
+		scheme = "HTTPS"
+	}
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		if gin.IsDebugging() {
+			s.logger.InfoF("Listening and serving %s on %s", scheme, l.Addr())
+		}
+		go func(l net.Listener) {
+			var err error
+			if useTLS {
+				err = httpServer.ServeTLS(l, "", "")
+			} else {
+				err = httpServer.Serve(l)
+			}
+			if err == http.ErrServerClosed {
+				err = nil
+			}
+			if err != nil {
+				_ = httpServer.Close()
+			}
+			errs <- err
+		}(l)
+	}
+
+	var result []error
+	for range listeners {
+		result = append(result, <-errs)
+	}
+	err := combineErrors(result...)
+	if err != nil {
+		s.stopBalancers()
+	}
 	return err
 }
+
+// RunWithSignals runs the server until SIGINT or SIGTERM arrives, then shuts
+// it down gracefully within timeout.
+func (s *server) RunWithSignals(timeout time.Duration, host ...string) error {
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(quit)
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- s.Run(host...)
+	}()
+
+	select {
+	case err := <-runErr:
+		return combineErrors(err, s.Shutdown(timeout))
+	case sig := <-quit:
+		s.logger.InfoF("received %s, shutting down", sig)
+	}
+
+	shutdownErr := s.Shutdown(timeout)
+	if shutdownErr != nil {
+		shutdownErr = fmt.Errorf("shutdown: %w", shutdownErr)
+	}
+	return combineErrors(<-runErr, shutdownErr)
+}
@@ -0,0 +1,43 @@
+package gateway
+
+import "reflect"
+
+// Shape decides how the default and JSON:API envelopes write results that
+// are not slices.
+type Shape string
+
+const (
+	// ShapeList wraps single results in a one element list, next to the
+	// pagination block. It is the default for backwards compatibility.
+	ShapeList Shape = "list"
+	// ShapeObject writes single results as objects without pagination, lists
+	// keep it.
+	ShapeObject Shape = "object"
+)
+
+// ShapeKey is the metadata key holding the Shape of a route, set it on a
+// group with WithMetadata or on a route with ResponseShape.
+const ShapeKey = "response_shape"
+
+// ResponseShape sets the Shape of the route it is registered on.
+func ResponseShape(shape Shape) Handler {
+	return Meta(ShapeKey, shape)
+}
+
+// Object is implemented by results written as objects whatever the Shape of
+// their route.
+type Object interface {
+	ResponseObject()
+}
+
+// isObject reports whether result is written as a single object.
+func isObject(req Request, result any) bool {
+	if result != nil && reflect.TypeOf(result).Kind() == reflect.Slice {
+		return false
+	}
+	if _, ok := result.(Object); ok {
+		return true
+	}
+	shape, _ := req.Route().Metadata.Get(ShapeKey)
+	return shape == ShapeObject
+}
@@ -0,0 +1,53 @@
+package gateway
+
+import (
+	"net/http"
+	"reflect"
+)
+
+// StatusPolicy picks the status code and success message of a response
+// whose handler set none. A zero status or empty message leaves it unset.
+type StatusPolicy func(req Request, result any) (status int, message string)
+
+// WithStatusPolicy makes the Responder consult policy before writing
+// successful responses, SetStatusCode and SetMessage still take precedence.
+func WithStatusPolicy(policy StatusPolicy) ResponderOption {
+	return func(r *responder) {
+		r.statusPolicy = policy
+	}
+}
+
+// MethodStatusPolicy answers empty results with 204 No Content, POST with
+// 201 Created and PUT and PATCH with 200 and the localized CreatedMessage
+// and UpdatedMessage.
+func MethodStatusPolicy(req Request, result any) (int, string) {
+	if isEmpty(result) {
+		return http.StatusNoContent, ""
+	}
+	switch req.GetMethod() {
+	case http.MethodPost:
+		return http.StatusCreated, localize(req, "CreatedMessage", "Item has been created successfully.")
+	case http.MethodPut, http.MethodPatch:
+		return http.StatusOK, localize(req, "UpdatedMessage", "Item has been updated successfully.")
+	}
+	return http.StatusOK, ""
+}
+
+func isEmpty(result any) bool {
+	if result == nil {
+		return true
+	}
+	v := reflect.ValueOf(result)
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
+func localize(req Request, id, message string) string {
+	if req.GetLanguage() == nil {
+		return message
+	}
+	return req.GetLanguage().Localize(id, message)
+}
@@ -0,0 +1,195 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is a Server-Sent Event, Data is written as is when it is a string
+// and as JSON otherwise.
+type Event struct {
+	ID    string
+	Name  string
+	Data  any
+	Retry time.Duration
+}
+
+// FromChannel adapts ch to the next function of StreamJSON, it stops when ch
+// is closed or ctx is done.
+func FromChannel[T any](ctx context.Context, ch <-chan T) func() (any, bool, error) {
+	return func() (any, bool, error) {
+		select {
+		case item, ok := <-ch:
+			return item, ok, nil
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+}
+
+// streamContext is done once the client goes away or the route deadline
+// passes.
+func (r *request) streamContext() context.Context {
+	if r.ctx != nil {
+		return r.ctx
+	}
+	return r.context.Request.Context()
+}
+
+// SendEvents streams events as Server-Sent Events until the channel is
+// closed or the client goes away, writing a comment every heartbeat to keep
+// idle connections open. A zero heartbeat disables it. Events whose ID or
+// Name span lines end the stream with an error.
+func (r *request) SendEvents(events <-chan Event, heartbeat time.Duration) error {
+	r.SetIsResponded(true)
+	w := r.context.Writer
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	w.Flush()
+
+	var tick <-chan time.Time
+	if heartbeat > 0 {
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	ctx := r.streamContext()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if err := writeEvent(w, event); err != nil {
+				return err
+			}
+		case <-tick:
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		w.Flush()
+	}
+}
+
+var lineBreaks = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+// writeEvent refuses ids and names spanning lines, they would let the
+// content of an event forge other fields or events.
+func writeEvent(w io.Writer, event Event) error {
+	if strings.ContainsAny(event.ID, "\r\n") || strings.ContainsAny(event.Name, "\r\n") {
+		return fmt.Errorf("gateway: event id %q or name %q contains a line break", event.ID, event.Name)
+	}
+	var b strings.Builder
+	if event.ID != "" {
+		b.WriteString("id: " + event.ID + "\n")
+	}
+	if event.Name != "" {
+		b.WriteString("event: " + event.Name + "\n")
+	}
+	if event.Retry > 0 {
+		b.WriteString("retry: " + strconv.FormatInt(event.Retry.Milliseconds(), 10) + "\n")
+	}
+	data, ok := event.Data.(string)
+	if !ok && event.Data != nil {
+		encoded, err := json.Marshal(event.Data)
+		if err != nil {
+			return err
+		}
+		data = string(encoded)
+	}
+	for _, line := range strings.Split(lineBreaks.Replace(data), "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// StreamJSON writes the items returned by next as newline delimited JSON,
+// flushing after each one, until next reports the end or fails.
+func (r *request) StreamJSON(next func() (item any, ok bool, err error)) error {
+	r.SetIsResponded(true)
+	w := r.context.Writer
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	ctx := r.streamContext()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		item, ok, err := next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			w.Flush()
+			return nil
+		}
+		if err = enc.Encode(item); err != nil {
+			return err
+		}
+		w.Flush()
+	}
+}
+
+// Download sends content as an attachment named name. Seekable content gets
+// Range and conditional request support, anything else is copied as is.
+func (r *request) Download(name string, content io.Reader, modTime time.Time) error {
+	r.SetIsResponded(true)
+	w := r.context.Writer
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	if seeker, ok := content.(io.ReadSeeker); ok {
+		http.ServeContent(w, r.context.Request, name, modTime, seeker)
+		return nil
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Accept-Ranges", "none")
+	if !modTime.IsZero() {
+		w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+	w.WriteHeader(http.StatusOK)
+	if r.GetMethod() == http.MethodHead {
+		return nil
+	}
+	_, err := io.Copy(w, content)
+	return err
+}
+
+// DownloadFile sends the file at path, named after its base name.
+func (r *request) DownloadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("gateway: %s is a directory", path)
+	}
+	return r.Download(info.Name(), f, info.ModTime())
+}
@@ -0,0 +1,190 @@
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"github.com/gin-gonic/gin"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// timeoutWriter passes the writes of a chain through to the client until its
+// deadline passes, after that they are dropped. Headers are kept aside and
+// copied on the first write so a late handler cannot touch the ones of the
+// timeout response. Every call checks the deadline first, so a chain that
+// outruns the watchdog still ends up with the timeout response.
+type timeoutWriter struct {
+	gin.ResponseWriter
+	mu       sync.Mutex
+	header   http.Header
+	ctx      context.Context
+	respond  func()
+	timedOut bool
+}
+
+func newTimeoutWriter(w gin.ResponseWriter, ctx context.Context, respond func()) *timeoutWriter {
+	return &timeoutWriter{ResponseWriter: w, header: w.Header().Clone(), ctx: ctx, respond: respond}
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.expire() {
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *timeoutWriter) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.expire() {
+		return
+	}
+	w.copyHeader()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.expire() {
+		return 0, http.ErrHandlerTimeout
+	}
+	w.copyHeader()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *timeoutWriter) Status() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ResponseWriter.Status()
+}
+
+func (w *timeoutWriter) Size() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ResponseWriter.Size()
+}
+
+func (w *timeoutWriter) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ResponseWriter.Written()
+}
+
+func (w *timeoutWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.expire() {
+		return
+	}
+	w.copyHeader()
+	w.ResponseWriter.Flush()
+}
+
+func (w *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.expire() {
+		return nil, nil, http.ErrHandlerTimeout
+	}
+	return w.ResponseWriter.Hijack()
+}
+
+// copyHeader must be called with mu held.
+func (w *timeoutWriter) copyHeader() {
+	if w.ResponseWriter.Written() {
+		return
+	}
+	dst := w.ResponseWriter.Header()
+	for k, v := range w.header {
+		dst[k] = v
+	}
+}
+
+// expire reports whether the deadline passed, the first time it sees so it
+// drops every later write and, when nothing was sent yet, writes the timeout
+// response. It must be called with mu held so the chain never reads the
+// writer while it is written.
+func (w *timeoutWriter) expire() bool {
+	if w.timedOut {
+		return true
+	}
+	if w.ctx.Err() != context.DeadlineExceeded {
+		return false
+	}
+	w.timedOut = true
+	if !w.ResponseWriter.Written() {
+		w.respond()
+	}
+	return true
+}
+
+func (w *timeoutWriter) timeout() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.expire()
+}
+
+// release copies the headers of a chain that ended in time and wrote nothing.
+func (w *timeoutWriter) release() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.expire() {
+		w.copyHeader()
+	}
+}
+
+// withTimeout gives the request a context that is cancelled after the
+// timeout of the group and sends the rest of the chain through a
+// timeoutWriter, unless an earlier handler of the chain already did. If the
+// deadline passes before the chain answers the client gets
+// DefaultTimeoutError and the later writes are dropped. The chain keeps
+// running on the gin context, the returned func must be called once it
+// returned. The context derives from the http.Request rather than the pooled
+// gin context.
+func (rg routerGroup) withTimeout(req Request) func() {
+	r, ok := req.(*request)
+	if _, set := req.GetContext().Deadline(); set || !ok {
+		return func() {}
+	}
+	ctx, cancel := context.WithTimeout(req.Request().Context(), rg.timeout)
+	req.SetContext(ctx)
+	c := r.context
+	// the timeout response may be written from another goroutine, on a copy
+	// that shares nothing with the running chain
+	late := r.clone(c.Copy())
+	late.context.Writer = c.Writer
+	tw := newTimeoutWriter(c.Writer, ctx, func() {
+		rg.controller.RespondError(late, DefaultTimeoutError)
+	})
+	c.Writer = tw
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			tw.timeout()
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+		cancel()
+		tw.release()
+		c.Writer = tw.ResponseWriter
+	}
+}
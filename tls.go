@@ -0,0 +1,127 @@
+package gateway
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+type TLSOptions struct {
+	// CertFile and KeyFile are watched and reloaded when they change on disk.
+	// They may be left empty when Config already carries certificates.
+	CertFile string
+	KeyFile  string
+	// Config is used as the base configuration, it is cloned before use.
+	Config *tls.Config
+	// ClientCAFile enables mutual TLS, client certificates are verified
+	// against the CAs in this file.
+	ClientCAFile string
+	// ClientAuth defaults to tls.RequireAndVerifyClientCert when ClientCAFile
+	// is set.
+	ClientAuth tls.ClientAuthType
+	// ReloadInterval is the minimum time between two checks of the
+	// certificate files, defaults to 10 seconds.
+	ReloadInterval time.Duration
+}
+
+func (o TLSOptions) build() (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if o.Config != nil {
+		config = o.Config.Clone()
+	}
+
+	if o.CertFile != "" || o.KeyFile != "" {
+		interval := o.ReloadInterval
+		if interval <= 0 {
+			interval = 10 * time.Second
+		}
+		reloader, err := newCertReloader(o.CertFile, o.KeyFile, interval)
+		if err != nil {
+			return nil, err
+		}
+		config.GetCertificate = reloader.GetCertificate
+	}
+
+	if o.ClientCAFile != "" {
+		pem, err := os.ReadFile(o.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", o.ClientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	if o.ClientAuth != tls.NoClientCert {
+		config.ClientAuth = o.ClientAuth
+	}
+	return config, nil
+}
+
+type certReloader struct {
+	mu        sync.Mutex
+	certFile  string
+	keyFile   string
+	interval  time.Duration
+	checkedAt time.Time
+	modTime   time.Time
+	cert      *tls.Certificate
+}
+
+func newCertReloader(certFile, keyFile string, interval time.Duration) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, interval: interval}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) load() error {
+	modTime, err := r.lastModified()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	r.checkedAt = time.Now()
+	return nil
+}
+
+func (r *certReloader) lastModified() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// GetCertificate hands out the current certificate, reloading it first when
+// the files changed since the last check. A failed reload keeps serving the
+// previous certificate, so a half-written rotation does not take the server
+// down.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.checkedAt) >= r.interval {
+		r.checkedAt = time.Now()
+		if modTime, err := r.lastModified(); err == nil && !modTime.Equal(r.modTime) {
+			_ = r.load()
+		}
+	}
+	return r.cert, nil
+}
@@ -0,0 +1,131 @@
+package gateway
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	errors "github.com/haderianous/go-error"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pair tls.Certificate
+}
+
+func newTestCert(t *testing.T, cn string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	assert.Nil(t, err)
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{cert: cert, key: key, pair: tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}}
+}
+
+func (c *testCert) write(t *testing.T, certFile, keyFile string) {
+	keyDer, _ := x509.MarshalECPrivateKey(c.key)
+	assert.Nil(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0600))
+	if keyFile != "" {
+		assert.Nil(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	}
+}
+
+type identityHandler struct{}
+
+func (h *identityHandler) Handle(req Request) (any, errors.ErrorModel) {
+	cert := req.GetClientCertificate()
+	if cert == nil {
+		return nil, errors.DefaultUnAuthorizedError
+	}
+	return cert.Subject.CommonName, nil
+}
+
+func TestServer_RunTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), filepath.Join(dir, "ca.pem")
+	ca := newTestCert(t, "ca", nil)
+	ca.write(t, caFile, "")
+	first := newTestCert(t, "first", ca)
+	first.write(t, certFile, keyFile)
+	client := newTestCert(t, "client-1", ca)
+
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := l.Addr().String()
+	_ = l.Close()
+
+	s := NewServer(NewController(NewResponder(nil), nil))
+	s.NewRouterGroup("").Get("whoami", &identityHandler{})
+	go func() {
+		_ = s.RunTLS(TLSOptions{
+			CertFile:       certFile,
+			KeyFile:        keyFile,
+			ClientCAFile:   caFile,
+			ReloadInterval: time.Millisecond,
+		}, addr)
+	}()
+	defer func() { _ = s.Shutdown(time.Second) }()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func() (*http.Response, error) {
+		c := &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{client.pair}},
+			ForceAttemptHTTP2: true,
+		}}
+		return c.Get("https://" + addr + "/whoami")
+	}
+
+	var res *http.Response
+	assert.Eventually(t, func() bool {
+		var err error
+		res, err = get()
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, 2, res.ProtoMajor)
+	assert.Equal(t, "first", res.TLS.PeerCertificates[0].Subject.CommonName)
+	body, _ := io.ReadAll(res.Body)
+	assert.Contains(t, string(body), "client-1")
+	_ = res.Body.Close()
+
+	second := newTestCert(t, "second", ca)
+	second.write(t, certFile, keyFile)
+	future := time.Now().Add(time.Minute)
+	_ = os.Chtimes(certFile, future, future)
+	time.Sleep(5 * time.Millisecond)
+
+	res, err := get()
+	assert.Nil(t, err)
+	assert.Equal(t, "second", res.TLS.PeerCertificates[0].Subject.CommonName)
+	_ = res.Body.Close()
+}
@@ -0,0 +1,60 @@
+package gateway
+
+import (
+	"context"
+	errors "github.com/haderianous/go-error"
+	"reflect"
+)
+
+// TypedFunc handles a request whose input has already been bound and
+// validated.
+type TypedFunc[In Validatable, Out any] func(ctx context.Context, in In, req Request) (Out, errors.ErrorModel)
+
+type typedHandler[In Validatable, Out any] struct {
+	fn TypedFunc[In, Out]
+}
+
+// Typed adapts fn to a Handler. A fresh In is bound with BindRequest on every
+// request; when Validate returns a value of type In it is handed to fn instead.
+func Typed[In Validatable, Out any](fn TypedFunc[In, Out]) Handler {
+	return &typedHandler[In, Out]{fn: fn}
+}
+
+func (h *typedHandler[In, Out]) Handle(req Request) (any, errors.ErrorModel) {
+	in := newInput[In]()
+	// a value In is bound through its address, a pointer one in place
+	target, ok := any(&in).(Validatable)
+	if !ok {
+		target = in
+	}
+	if err := req.BindRequest(target); err != nil {
+		return nil, err
+	}
+	if body, ok := req.GetBody().(In); ok {
+		in = body
+	}
+	return h.fn(req.GetContext(), in, req)
+}
+
+func (h *typedHandler[In, Out]) routeTypes() (Validatable, any) {
+	var out Out
+	return newInput[In](), out
+}
+
+// newInput allocates the value In points to, so binding has somewhere to
+// write.
+func newInput[In Validatable]() In {
+	var in In
+	t := reflect.TypeOf(&in).Elem()
+	if t.Kind() == reflect.Ptr {
+		return reflect.New(t.Elem()).Interface().(In)
+	}
+	return in
+}
+
+// Empty is the input of typed handlers that read nothing from the request.
+type Empty struct{}
+
+func (e *Empty) Validate(Language) (any, error, map[string]any) {
+	return e, nil, nil
+}
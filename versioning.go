@@ -0,0 +1,181 @@
+package gateway
+
+import (
+	errors "github.com/haderianous/go-error"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultVersion = "v1"
+
+type VersionOption func(v *apiVersion)
+
+type apiVersion struct {
+	name       string
+	base       string
+	isDefault  bool
+	deprecated time.Time
+	sunset     time.Time
+}
+
+// DefaultVersion serves requests that do not ask for a version.
+func DefaultVersion() VersionOption {
+	return func(v *apiVersion) {
+		v.isDefault = true
+	}
+}
+
+// DeprecatedAt adds a Deprecation header to the responses of the version.
+func DeprecatedAt(at time.Time) VersionOption {
+	return func(v *apiVersion) {
+		v.deprecated = at
+	}
+}
+
+// SunsetAt adds a Sunset header announcing when the version goes away.
+func SunsetAt(at time.Time) VersionOption {
+	return func(v *apiVersion) {
+		v.sunset = at
+	}
+}
+
+type versionSet struct {
+	mu       sync.RWMutex
+	versions []*apiVersion
+}
+
+func (vs *versionSet) add(v *apiVersion) {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	vs.versions = append(vs.versions, v)
+	// longest base first, so nested groups win over their parents
+	sort.SliceStable(vs.versions, func(i, j int) bool {
+		return len(vs.versions[i].base) > len(vs.versions[j].base)
+	})
+}
+
+// rewrite inserts the requested, or default, version into the path of a
+// request that does not carry one, provided a route serves the result and
+// none serves the path as it is.
+func (vs *versionSet) rewrite(r *http.Request, routes *routeTable) {
+	if vs == nil {
+		return
+	}
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+	if len(vs.versions) == 0 {
+		return
+	}
+
+	path := r.URL.Path
+	if routes.match(path) {
+		return
+	}
+	requested := requestedVersions(r)
+	for _, v := range vs.versions {
+		rest, ok := trimBase(path, v.base)
+		if !ok {
+			continue
+		}
+		if vs.lookup(v.base, firstSegment(rest)) != nil {
+			return
+		}
+		selected := vs.selectVersion(v.base, requested)
+		if selected == nil {
+			continue
+		}
+		candidate := joinPaths(selected.base, selected.name) + rest
+		if routes.match(candidate) {
+			r.URL.Path = candidate
+			r.URL.RawPath = ""
+			return
+		}
+	}
+}
+
+func (vs *versionSet) lookup(base, name string) *apiVersion {
+	for _, v := range vs.versions {
+		if v.base == base && v.name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+func (vs *versionSet) selectVersion(base string, requested []string) *apiVersion {
+	for _, name := range requested {
+		for _, candidate := range []string{name, "v" + name} {
+			if v := vs.lookup(base, candidate); v != nil {
+				return v
+			}
+		}
+	}
+	if len(requested) > 0 {
+		return nil
+	}
+	for _, v := range vs.versions {
+		if v.base == base && v.isDefault {
+			return v
+		}
+	}
+	return nil
+}
+
+// requestedVersions reads the Accept-Version header, then the version
+// parameter of the Accept media types.
+func requestedVersions(r *http.Request) []string {
+	if v := strings.TrimSpace(r.Header.Get("Accept-Version")); v != "" {
+		return []string{v}
+	}
+	var versions []string
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		_, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		if v := params["version"]; v != "" {
+			versions = append(versions, v)
+		}
+	}
+	return versions
+}
+
+func trimBase(path, base string) (string, bool) {
+	base = strings.TrimSuffix(base, "/")
+	if !strings.HasPrefix(path, base) {
+		return "", false
+	}
+	rest := path[len(base):]
+	if rest != "" && rest[0] != '/' {
+		return "", false
+	}
+	return rest, true
+}
+
+func firstSegment(path string) string {
+	path = strings.TrimPrefix(path, "/")
+	if i := strings.Index(path, "/"); i >= 0 {
+		return path[:i]
+	}
+	return path
+}
+
+type deprecationHandler struct {
+	version *apiVersion
+}
+
+func (h *deprecationHandler) Handle(req Request) (any, errors.ErrorModel) {
+	header := req.Writer().Header()
+	if !h.version.deprecated.IsZero() {
+		header.Set("Deprecation", "@"+strconv.FormatInt(h.version.deprecated.Unix(), 10))
+	}
+	if !h.version.sunset.IsZero() {
+		header.Set("Sunset", h.version.sunset.UTC().Format(http.TimeFormat))
+	}
+	return nil, nil
+}
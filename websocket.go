@@ -0,0 +1,192 @@
+package gateway
+
+import (
+	"github.com/gorilla/websocket"
+	errors "github.com/haderianous/go-error"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const defaultPingInterval = 30 * time.Second
+
+// WebSocketFunc serves an upgraded connection, the connection is closed once
+// it returns.
+type WebSocketFunc func(conn *WebSocketConn, req Request) errors.ErrorModel
+
+type WebSocketOption func(h *webSocketHandler)
+
+// WithPingInterval sets how often the server pings the client, a client
+// missing two pings in a row is disconnected.
+func WithPingInterval(interval time.Duration) WebSocketOption {
+	return func(h *webSocketHandler) {
+		h.pingInterval = interval
+	}
+}
+
+// WithCheckOrigin replaces the default same origin check of upgrade
+// requests.
+func WithCheckOrigin(check func(r *http.Request) bool) WebSocketOption {
+	return func(h *webSocketHandler) {
+		h.upgrader.CheckOrigin = check
+	}
+}
+
+type webSocketHandler struct {
+	fn           WebSocketFunc
+	upgrader     websocket.Upgrader
+	pingInterval time.Duration
+	sockets      *socketSet
+}
+
+// NewWebSocketHandler upgrades the request and hands the connection to fn.
+// Register it as the last handler of RouterGroup.WebSocket so connections
+// are closed on Server.Shutdown.
+func NewWebSocketHandler(fn WebSocketFunc, opts ...WebSocketOption) Handler {
+	h := &webSocketHandler{fn: fn, pingInterval: defaultPingInterval}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+func (h *webSocketHandler) Handle(req Request) (any, errors.ErrorModel) {
+	if !websocket.IsWebSocketUpgrade(req.Request()) {
+		return nil, errors.DefaultBadRequestError
+	}
+	req.SetIsResponded(true)
+	ws, err := h.upgrader.Upgrade(req.Writer(), req.Request(), nil)
+	if err != nil {
+		// the upgrader already answered with an HTTP error
+		return nil, nil
+	}
+	conn := newWebSocketConn(ws, h.pingInterval)
+	defer conn.Close()
+	if !h.sockets.add(conn) {
+		return nil, nil
+	}
+	defer h.sockets.remove(conn)
+	return nil, h.fn(conn, req)
+}
+
+// WebSocketConn wraps an upgraded connection, writes are safe for concurrent
+// use while reads must come from a single goroutine.
+type WebSocketConn struct {
+	conn      *websocket.Conn
+	writeMu   sync.Mutex
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func newWebSocketConn(ws *websocket.Conn, pingInterval time.Duration) *WebSocketConn {
+	c := &WebSocketConn{conn: ws, done: make(chan struct{})}
+	if pingInterval > 0 {
+		pongWait := 2 * pingInterval
+		_ = ws.SetReadDeadline(time.Now().Add(pongWait))
+		ws.SetPongHandler(func(string) error {
+			return ws.SetReadDeadline(time.Now().Add(pongWait))
+		})
+		go c.keepalive(pingInterval)
+	}
+	return c
+}
+
+func (c *WebSocketConn) keepalive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.writeMu.Lock()
+			err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(interval))
+			c.writeMu.Unlock()
+			if err != nil {
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// ReadJSON blocks until the next message and decodes it into v.
+func (c *WebSocketConn) ReadJSON(v any) error {
+	return c.conn.ReadJSON(v)
+}
+
+func (c *WebSocketConn) WriteJSON(v any) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.conn.WriteJSON(v)
+}
+
+// Done is closed once the connection is.
+func (c *WebSocketConn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Conn exposes the underlying connection for binary or raw text messages.
+func (c *WebSocketConn) Conn() *websocket.Conn {
+	return c.conn
+}
+
+// Close sends a normal closure frame and closes the connection.
+func (c *WebSocketConn) Close() error {
+	return c.close(websocket.CloseNormalClosure, "")
+}
+
+func (c *WebSocketConn) close(code int, reason string) error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.writeMu.Lock()
+		_ = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+		c.writeMu.Unlock()
+		err = c.conn.Close()
+	})
+	return err
+}
+
+// socketSet tracks the open connections of a server to close them on
+// shutdown.
+type socketSet struct {
+	mu     sync.Mutex
+	conns  map[*WebSocketConn]struct{}
+	closed bool
+}
+
+func (s *socketSet) add(c *WebSocketConn) bool {
+	if s == nil {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	if s.conns == nil {
+		s.conns = map[*WebSocketConn]struct{}{}
+	}
+	s.conns[c] = struct{}{}
+	return true
+}
+
+func (s *socketSet) remove(c *WebSocketConn) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, c)
+}
+
+func (s *socketSet) closeAll() {
+	s.mu.Lock()
+	s.closed = true
+	conns := s.conns
+	s.conns = nil
+	s.mu.Unlock()
+	for c := range conns {
+		_ = c.close(websocket.CloseGoingAway, "server shutting down")
+	}
+}